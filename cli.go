@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// commandOptions holds the flags shared by every command
+type commandOptions struct {
+	configFile string // --config, empty = search the default locations
+	logLevel   string // --log-level
+	jsonOutput bool   // --json
+	profile    string // --profile, only registered by the commands that run the monitor
+	dryRun     bool   // --dry-run, only registered by the commands that change resolutions
+}
+
+// command is a csres subcommand
+type command struct {
+	name    string
+	aliases []string                                        // Optional: other names the command can be run with
+	args    string                                          // Positional arguments shown in the usage, e.g. "<monitor> <mode>"
+	summary string                                          // One line description for the command list
+	flags   func(fs *flag.FlagSet, opts *commandOptions)    // Optional: registers the command's own flags
+	run     func(opts *commandOptions, args []string) error // Runs the command with its positional arguments
+	logFile bool                                            // Whether the log is also written to csres.log, for commands that keep running
+}
+
+// usageError is returned for invalid arguments, the command's usage is printed with it
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+// exitCode is returned by commands that already reported their result and only
+// need to set the exit code, e.g. validate with --json
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// commands returns every command in the order they are listed in the help
+func commands() []*command {
+	return []*command{
+		guiCommand(),
+		runCommand(),
+		monitorsCommand(),
+		modesCommand(),
+		setCommand(),
+		statusCommand(),
+		validateCommand(),
+		execCommand(),
+		ctlCommand(),
+		configCommand(),
+		doctorCommand(),
+		versionCommand(),
+	}
+}
+
+// findCommand returns the command with the given name, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// Execute runs the command line and returns the process exit code. Without a
+// command the GUI is started; a config file given as the first argument and the
+// --cli flag of earlier versions are still accepted.
+func Execute(args []string) int {
+	opts := &commandOptions{logLevel: "info"}
+
+	// --cli from earlier versions selects the run command wherever it appears
+	defaultCommand := "gui"
+	var rest []string
+	for _, arg := range args {
+		if arg == "--cli" || arg == "-c" {
+			defaultCommand = "run"
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	// Without a command gui or run is started, so their flags are accepted here too
+	fs := newFlagSet("csres", opts)
+	monitorFlags(fs, opts)
+	var showVersion bool
+	fs.BoolVar(&showVersion, "version", false, "")
+	fs.BoolVar(&showVersion, "v", false, "")
+	if err := fs.Parse(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(os.Stdout)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "csres: %v\n", err)
+		printUsage(os.Stderr)
+		return 2
+	}
+	if showVersion {
+		defaultCommand = "version"
+	}
+
+	cmd := findCommand(defaultCommand)
+	rest = fs.Args()
+	if len(rest) > 0 {
+		if rest[0] == "help" {
+			return runHelp(rest[1:])
+		}
+		if found := findCommand(rest[0]); found != nil {
+			cmd = found
+			rest = rest[1:]
+		}
+		// Anything else is the config file argument of gui or run
+	}
+
+	return runCommandLine(cmd, opts, rest)
+}
+
+// runCommandLine parses the arguments of a command, runs it and reports errors
+func runCommandLine(cmd *command, opts *commandOptions, args []string) int {
+	fs := newFlagSet("csres "+cmd.name, opts)
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printCommandUsage(os.Stdout, cmd, fs)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "csres %s: %v\n", cmd.name, err)
+		printCommandUsage(os.Stderr, cmd, fs)
+		return 2
+	}
+
+	if err := SetupLogging(opts.logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "csres %s: %v\n", cmd.name, err)
+		return 2
+	}
+	if cmd.logFile {
+		if err := EnableLogFile(); err != nil {
+			logWarnf("Warning: %v, logging to the console only", err)
+		}
+	}
+
+	err = cmd.run(opts, positional)
+
+	var code exitCode
+	var usage usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &code):
+		return int(code)
+	case errors.As(err, &usage):
+		fmt.Fprintf(os.Stderr, "csres %s: %v\n", cmd.name, err)
+		printCommandUsage(os.Stderr, cmd, fs)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "csres %s: %v\n", cmd.name, err)
+	return 1
+}
+
+// newFlagSet creates a flag set with the flags shared by every command
+func newFlagSet(name string, opts *commandOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard) // Errors and usage are printed by the caller
+	fs.StringVar(&opts.configFile, "config", opts.configFile, "config file to use instead of searching the default locations")
+	fs.StringVar(&opts.logLevel, "log-level", opts.logLevel, "log messages to show: debug, info, warn or error")
+	fs.BoolVar(&opts.jsonOutput, "json", opts.jsonOutput, "print machine-readable JSON instead of text")
+	return fs
+}
+
+// parseArgs parses flags that may appear before, between or after positional
+// arguments, and returns the positional ones. Everything after "--" is positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		consumed := len(args) - len(rest)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// printUsage prints the list of commands and the shared flags
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "CS Resolution Monitor")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  csres [command] [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-34s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+	fmt.Fprintf(w, "  %-34s %s\n", "help [command]", "Show help for a command")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags accepted by every command:")
+	fmt.Fprintln(w, "  --config <file>      Config file to use")
+	fmt.Fprintln(w, "  --log-level <level>  Log messages to show: debug, info (default), warn or error")
+	fmt.Fprintln(w, "  --json               Print machine-readable JSON instead of text")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without --config, the config is looked up in this order:")
+	fmt.Fprintf(w, "  the %s environment variable, the csres folder in the user config\n", ConfigEnvVar)
+	fmt.Fprintf(w, "  directory (%%APPDATA%%\\csres or $XDG_CONFIG_HOME/csres), then next to the executable.\n")
+}
+
+// printCommandUsage prints the usage and flags of a single command
+func printCommandUsage(w io.Writer, cmd *command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: csres %s [flags]\n", strings.TrimSpace(cmd.name+" "+cmd.args))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, cmd.summary)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	fs.SetOutput(io.Discard)
+}
+
+// runHelp prints the usage of a command, or the command list
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "csres help: unknown command %q\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	opts := &commandOptions{logLevel: "info"}
+	fs := newFlagSet("csres "+cmd.name, opts)
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+	printCommandUsage(os.Stdout, cmd, fs)
+	return 0
+}
+
+// resolveConfig returns the config file to use: the positional argument, --config
+// or the first one found in the default locations
+func (opts *commandOptions) resolveConfig(args []string) (string, error) {
+	explicit := opts.configFile
+	if len(args) > 0 {
+		explicit = args[0]
+	}
+
+	configFile, source, err := ResolveConfigPath(explicit)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config file: %w", err)
+	}
+	log.Printf("Using config file %s (%s)", configFile, source)
+	return configFile, nil
+}
+
+// printJSON writes a value to standard output as indented JSON
+func printJSON(value any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
+
+// expectArgs returns a usageError unless between min and max positional
+// arguments were given
+func expectArgs(args []string, min, max int) error {
+	switch {
+	case len(args) < min:
+		return usageError{"missing arguments"}
+	case len(args) > max:
+		return usageError{fmt.Sprintf("unexpected argument %q", args[max])}
+	}
+	return nil
+}
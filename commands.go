@@ -0,0 +1,564 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"csres/version"
+)
+
+// guiCommand starts the GUI, the default when no command is given
+func guiCommand() *command {
+	return &command{
+		name:    "gui",
+		args:    "[config-file]",
+		summary: "Start the GUI with the tray icon (default)",
+		flags:   monitorFlags,
+		logFile: true,
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 1); err != nil {
+				return err
+			}
+			configFile, err := opts.resolveConfig(args)
+			if err != nil {
+				return err
+			}
+			return runGUIMode(configFile, opts.profile, opts.dryRun)
+		},
+	}
+}
+
+// runCommand runs the monitoring loop in the foreground without the GUI
+func runCommand() *command {
+	return &command{
+		name:    "run",
+		args:    "[config-file]",
+		summary: "Monitor applications in the foreground without the GUI",
+		flags:   monitorFlags,
+		logFile: true,
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 1); err != nil {
+				return err
+			}
+			configFile, err := opts.resolveConfig(args)
+			if err != nil {
+				return err
+			}
+			return runCLIMode(configFile, opts.profile, opts.dryRun, opts.jsonOutput)
+		},
+	}
+}
+
+// monitorFlags registers the flags of the commands that run the monitor
+func monitorFlags(fs *flag.FlagSet, opts *commandOptions) {
+	fs.StringVar(&opts.profile, "profile", opts.profile, "profile from the config file to use")
+	fs.StringVar(&opts.profile, "p", opts.profile, "shorthand for --profile")
+	dryRunFlag(fs, opts)
+}
+
+// dryRunFlag registers --dry-run for the commands that change resolutions
+func dryRunFlag(fs *flag.FlagSet, opts *commandOptions) {
+	fs.BoolVar(&opts.dryRun, "dry-run", opts.dryRun, "log resolution changes instead of making them")
+}
+
+// monitorsCommand lists the connected monitors with their current mode
+func monitorsCommand() *command {
+	var withModes bool
+	return &command{
+		name:    "monitors",
+		summary: "List connected monitors and their current modes",
+		flags: func(fs *flag.FlagSet, opts *commandOptions) {
+			fs.BoolVar(&withModes, "modes", false, "also list the modes each monitor supports")
+		},
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 0); err != nil {
+				return err
+			}
+
+			displayManager := NewDisplayManager()
+			inventory, err := loadInventory(displayManager)
+			if err != nil {
+				return err
+			}
+
+			monitors := []MonitorStatus{}
+			for _, monitor := range inventory.Monitors() {
+				output := newMonitorStatus(monitor)
+				if res, err := displayManager.GetCurrentResolutionForMonitor(monitor.DeviceName); err == nil {
+					output.Current = res
+				} else {
+					logWarnf("Warning: failed to get resolution for monitor %s: %v", monitor.DeviceName, err)
+				}
+				if withModes {
+					if modes, err := displayManager.GetAvailableResolutions(monitor.DeviceName); err == nil {
+						sortResolutions(modes)
+						output.Modes = modes
+					} else {
+						logWarnf("Warning: failed to get modes of monitor %s: %v", monitor.DeviceName, err)
+					}
+				}
+				monitors = append(monitors, output)
+			}
+
+			if opts.jsonOutput {
+				return printJSON(MonitorsOutput{SchemaVersion: OutputSchemaVersion, Monitors: monitors})
+			}
+
+			if len(monitors) == 0 {
+				fmt.Println("No monitors detected")
+				return nil
+			}
+			for _, monitor := range monitors {
+				primaryMarker := ""
+				if monitor.Primary {
+					primaryMarker = " (Primary)"
+				}
+				fmt.Printf("%s  %s%s\n", monitor.DeviceName, monitor.Name, primaryMarker)
+				if monitor.Current != nil {
+					fmt.Printf("  current mode: %s\n", FormatResolution(*monitor.Current))
+				}
+				if monitor.Native != nil {
+					fmt.Printf("  native mode:  %s\n", FormatResolution(*monitor.Native))
+				}
+				if monitor.StableID != "" {
+					fmt.Printf("  stable id:    %s\n", monitor.StableID)
+				}
+				if len(monitor.Modes) > 0 {
+					fmt.Println("  modes:")
+					for _, mode := range monitor.Modes {
+						fmt.Printf("    %s\n", FormatResolution(mode))
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// modesCommand lists the modes a monitor supports
+func modesCommand() *command {
+	return &command{
+		name:    "modes",
+		args:    "<monitor>",
+		summary: "List the modes a monitor supports",
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			displayManager := NewDisplayManager()
+			inventory, err := loadInventory(displayManager)
+			if err != nil {
+				return err
+			}
+			deviceName, err := resolveMonitorArgument(inventory, args[0])
+			if err != nil {
+				return err
+			}
+
+			modes, err := displayManager.GetAvailableResolutions(deviceName)
+			if err != nil {
+				return fmt.Errorf("failed to get modes of %s: %w", deviceName, err)
+			}
+			sortResolutions(modes)
+
+			output := ModesOutput{SchemaVersion: OutputSchemaVersion, DeviceName: deviceName, Modes: modes}
+			if res, err := displayManager.GetCurrentResolutionForMonitor(deviceName); err == nil {
+				output.Current = res
+			}
+
+			if opts.jsonOutput {
+				if output.Modes == nil {
+					output.Modes = []Resolution{}
+				}
+				return printJSON(output)
+			}
+
+			fmt.Printf("Modes supported by %s:\n", deviceName)
+			for _, mode := range modes {
+				marker := ""
+				if output.Current != nil && IsResolutionEqual(mode, *output.Current) {
+					marker = " (current)"
+				}
+				fmt.Printf("  %s%s\n", FormatResolution(mode), marker)
+			}
+			return nil
+		},
+	}
+}
+
+// setCommand changes the mode of a monitor
+func setCommand() *command {
+	var persist bool
+	return &command{
+		name:    "set",
+		args:    "<monitor> <mode>",
+		summary: "Set the mode of a monitor, e.g. csres set DISPLAY1 1280x960@144",
+		flags: func(fs *flag.FlagSet, opts *commandOptions) {
+			fs.BoolVar(&persist, "persist", false, "write the mode to the registry so it survives signing out")
+			dryRunFlag(fs, opts)
+		},
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 2, 2); err != nil {
+				return err
+			}
+			res, err := ParseResolution(args[1])
+			if err != nil {
+				return usageError{err.Error()}
+			}
+
+			displayManager := NewDisplayManager()
+			inventory, err := loadInventory(displayManager)
+			if err != nil {
+				return err
+			}
+			deviceName, err := resolveMonitorArgument(inventory, args[0])
+			if err != nil {
+				return err
+			}
+
+			previous, err := displayManager.GetCurrentResolutionForMonitor(deviceName)
+			if err != nil {
+				return fmt.Errorf("failed to get resolution of %s: %w", deviceName, err)
+			}
+			modes, err := displayManager.GetAvailableResolutions(deviceName)
+			if err != nil {
+				return fmt.Errorf("failed to get modes of %s: %w", deviceName, err)
+			}
+			res, err = supportedMode(res, *previous, modes)
+			if err != nil {
+				return fmt.Errorf("%w by %s, run csres modes %s to list the supported modes", err, deviceName, args[0])
+			}
+
+			// The change has to outlive this process, which exits right away
+			displayManager.SetDynamic(true)
+			displayManager.SetPersistent(persist)
+			displayManager.SetDryRun(opts.dryRun)
+			if err := displayManager.SetResolution(deviceName, res); err != nil {
+				return err
+			}
+
+			if opts.jsonOutput {
+				return printJSON(SetOutput{
+					SchemaVersion: OutputSchemaVersion,
+					DeviceName:    deviceName,
+					Previous:      previous,
+					Resolution:    res,
+					Persistent:    persist,
+					DryRun:        opts.dryRun,
+				})
+			}
+			if opts.dryRun {
+				fmt.Printf("Would set %s to %s (currently %s)\n", deviceName, FormatResolution(res), FormatResolution(*previous))
+				return nil
+			}
+			fmt.Printf("Set %s to %s (was %s)\n", deviceName, FormatResolution(res), FormatResolution(*previous))
+			return nil
+		},
+	}
+}
+
+// supportedMode checks a requested mode against the modes of a monitor. Without a
+// refresh rate the current rate is kept if the mode supports it, otherwise the
+// highest one is used.
+func supportedMode(res, current Resolution, modes []Resolution) (Resolution, error) {
+	var best *Resolution
+	for i, mode := range modes {
+		if mode.Width != res.Width || mode.Height != res.Height {
+			continue
+		}
+		if mode.Frequency == res.Frequency || (res.Frequency == 0 && mode.Frequency == current.Frequency) {
+			return mode, nil
+		}
+		if res.Frequency == 0 && (best == nil || mode.Frequency > best.Frequency) {
+			best = &modes[i]
+		}
+	}
+	if best != nil {
+		return *best, nil
+	}
+	return Resolution{}, fmt.Errorf("mode %s is not supported", FormatResolution(res))
+}
+
+// statusCommand shows the config in use, its rules and which of their applications are running
+func statusCommand() *command {
+	return &command{
+		name:    "status",
+		args:    "[config-file]",
+		summary: "Show the config in use, its rules and which applications are running",
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 1); err != nil {
+				return err
+			}
+			configFile, err := opts.resolveConfig(args)
+			if err != nil {
+				return err
+			}
+			config, err := LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+
+			running, err := NewProcessMonitor().MonitorProcesses(config)
+			if err != nil {
+				return err
+			}
+
+			displayManager := NewDisplayManager()
+			inventory, err := loadInventory(displayManager)
+			if err != nil {
+				return err
+			}
+
+			output := ConfigStatus{
+				SchemaVersion:     OutputSchemaVersion,
+				ConfigFile:        configFile,
+				ActiveProfile:     config.ActiveProfile,
+				Profiles:          config.ProfileNames(),
+				PollInterval:      config.EffectivePollInterval(),
+				PersistResolution: config.EffectivePersistResolution(),
+				Rules:             newRuleStatuses(config, running),
+				Monitors:          []MonitorStatus{},
+			}
+			for _, monitor := range inventory.Monitors() {
+				item := newMonitorStatus(monitor)
+				if res, err := displayManager.GetCurrentResolutionForMonitor(monitor.DeviceName); err == nil {
+					item.Current = res
+				}
+				output.Monitors = append(output.Monitors, item)
+			}
+
+			if opts.jsonOutput {
+				return printJSON(output)
+			}
+
+			fmt.Printf("Config:        %s\n", output.ConfigFile)
+			fmt.Printf("Profile:       %s\n", describeProfile(output.ActiveProfile))
+			fmt.Printf("Poll interval: %ds\n", output.PollInterval)
+			fmt.Println("Rules:")
+			if len(output.Rules) == 0 {
+				fmt.Println("  none")
+			}
+			for _, rule := range output.Rules {
+				monitorDesc := "primary monitor"
+				if rule.MonitorName != "" {
+					monitorDesc = rule.MonitorName
+				}
+				state := "not running"
+				if rule.Running {
+					state = "running"
+				}
+				fmt.Printf("  %s: %s on %s (%s)\n", rule.ProcessName, FormatResolution(rule.Resolution), monitorDesc, state)
+			}
+			fmt.Println("Monitors:")
+			for _, monitor := range output.Monitors {
+				mode := "unknown mode"
+				if monitor.Current != nil {
+					mode = FormatResolution(*monitor.Current)
+				}
+				fmt.Printf("  %s: %s - %s\n", monitor.DeviceName, monitor.Name, mode)
+			}
+			return nil
+		},
+	}
+}
+
+// validateCommand checks a config file, including the monitors its rules refer to
+func validateCommand() *command {
+	return &command{
+		name:    "validate",
+		args:    "[config-file]",
+		summary: "Check a config file and the monitors its rules refer to",
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 1); err != nil {
+				return err
+			}
+			configFile, err := opts.resolveConfig(args)
+			if err != nil {
+				return err
+			}
+
+			config, err := LoadConfig(configFile)
+			if err == nil {
+				// Monitors are only checked where they can be listed, the config may be meant for another PC
+				if monitors, monitorErr := NewDisplayManager().GetAvailableMonitors(); monitorErr == nil {
+					err = ValidateConfigMonitors(config, monitors)
+				} else {
+					logWarnf("Warning: failed to get available monitors, monitor names were not checked: %v", monitorErr)
+				}
+			}
+
+			if opts.jsonOutput {
+				if printErr := printJSON(validateResult(configFile, err)); printErr != nil {
+					return printErr
+				}
+				if err != nil {
+					return exitCode(1)
+				}
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s is valid: %d rules, %d profiles\n", configFile, len(config.Rules()), len(config.ProfileNames()))
+			return nil
+		},
+	}
+}
+
+// validateResult converts the result of loading a config to the validate output
+func validateResult(configFile string, err error) ValidateOutput {
+	output := ValidateOutput{SchemaVersion: OutputSchemaVersion, ConfigFile: configFile, Valid: err == nil, Issues: []ValidateIssue{}}
+
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		if err != nil {
+			output.Error = err.Error()
+		}
+		return output
+	}
+
+	for _, issue := range configErr.Issues {
+		file := issue.File
+		if file == "" {
+			file = configErr.File
+		}
+		output.Issues = append(output.Issues, ValidateIssue{
+			File:    file,
+			Line:    issue.Pos.Line,
+			Column:  issue.Pos.Column,
+			Path:    issue.Path,
+			Message: issue.Message,
+		})
+	}
+	return output
+}
+
+// configCommand groups the commands that work on the config file format
+func configCommand() *command {
+	var force bool
+	return &command{
+		name:    "config",
+		args:    "schema|migrate [config-file]",
+		summary: "Print the JSON Schema of the config file or upgrade it to the current version",
+		flags: func(fs *flag.FlagSet, opts *commandOptions) {
+			fs.BoolVar(&force, "force", false, "migrate: rewrite the file even if conf.d or per-user files are layered on top of it")
+		},
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 1, 2); err != nil {
+				return err
+			}
+			switch args[0] {
+			case "schema":
+				if err := expectArgs(args, 1, 1); err != nil {
+					return err
+				}
+				data, err := ConfigSchemaJSON()
+				if err != nil {
+					return err
+				}
+				_, err = os.Stdout.Write(data)
+				return err
+			case "migrate":
+				return migrateConfigCommand(opts, args[1:], force)
+			}
+			return usageError{fmt.Sprintf("unknown config command %q", args[0])}
+		},
+	}
+}
+
+// migrateConfigCommand rewrites an outdated config file in the current schema version
+func migrateConfigCommand(opts *commandOptions, args []string, force bool) error {
+	configFile, err := opts.resolveConfig(args)
+	if err != nil {
+		return err
+	}
+
+	from, err := UpgradeConfigFile(configFile, force)
+	if err != nil {
+		return err
+	}
+	if from == CurrentConfigVersion {
+		fmt.Printf("%s is already at version %d\n", configFile, CurrentConfigVersion)
+		return nil
+	}
+	fmt.Printf("%s upgraded from version %d to %d, original saved as %s\n", configFile, from, CurrentConfigVersion, configBackupPath(configFile, from))
+	return nil
+}
+
+// versionCommand prints the version
+func versionCommand() *command {
+	return &command{
+		name:    "version",
+		summary: "Show the version",
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 0); err != nil {
+				return err
+			}
+
+			info := version.Get()
+			if opts.jsonOutput {
+				return printJSON(VersionOutput{SchemaVersion: OutputSchemaVersion, Info: info})
+			}
+			fmt.Printf("CS Resolution Monitor %s\n", info)
+			return nil
+		},
+	}
+}
+
+// loadInventory enumerates the connected monitors
+func loadInventory(displayManager *DisplayManager) (*MonitorInventory, error) {
+	inventory := NewMonitorInventory(displayManager)
+	if _, _, err := inventory.Refresh(); err != nil {
+		return nil, fmt.Errorf("failed to get available monitors: %w", err)
+	}
+	return inventory, nil
+}
+
+// resolveMonitorArgument converts a monitor given on the command line to its device
+// name. Besides everything monitor_name accepts, "primary" and DISPLAYn without
+// the \\.\ prefix are understood.
+func resolveMonitorArgument(inventory *MonitorInventory, arg string) (string, error) {
+	monitors := inventory.Monitors()
+
+	switch {
+	case arg == "" || strings.EqualFold(arg, "primary"):
+		for _, monitor := range monitors {
+			if monitor.IsPrimary {
+				return monitor.DeviceName, nil
+			}
+		}
+		return "", fmt.Errorf("no primary monitor detected")
+	case strings.HasPrefix(strings.ToUpper(arg), "DISPLAY") && !isDeviceName(arg):
+		arg = `\\.\` + arg
+	}
+
+	deviceName, err := inventory.Resolve(arg)
+	if err != nil {
+		return "", err
+	}
+	for _, monitor := range monitors {
+		if strings.EqualFold(monitor.DeviceName, deviceName) {
+			return monitor.DeviceName, nil
+		}
+	}
+	return "", fmt.Errorf("monitor %s not found, run csres monitors to list the connected monitors", arg)
+}
+
+// sortResolutions orders modes from the largest to the smallest, fastest rate first
+func sortResolutions(modes []Resolution) {
+	sort.Slice(modes, func(i, j int) bool {
+		if modes[i].Width != modes[j].Width {
+			return modes[i].Width > modes[j].Width
+		}
+		if modes[i].Height != modes[j].Height {
+			return modes[i].Height > modes[j].Height
+		}
+		return modes[i].Frequency > modes[j].Frequency
+	})
+}
@@ -2,14 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 )
 
 // Resolution represents screen resolution settings
 type Resolution struct {
-	Width     uint32 `json:"width"`
-	Height    uint32 `json:"height"`
+	Width     uint32 `json:"width" min:"1"`
+	Height    uint32 `json:"height" min:"1"`
 	Frequency uint32 `json:"frequency,omitempty"` // Optional refresh rate
 }
 
@@ -19,45 +22,172 @@ type AppConfig struct {
 	Resolution        Resolution  `json:"resolution"`
 	MonitorName       string      `json:"monitor_name"`                 // Required: specific monitor name, empty = primary
 	RestoreResolution *Resolution `json:"restore_resolution,omitempty"` // Optional: resolution to restore to when app closes. If nil, uses original resolution
+	Disabled          bool        `json:"disabled,omitempty"`           // Optional: switches off a rule inherited from another config layer
 }
 
+// defaultPollInterval is the poll interval in seconds used when none is set
+const defaultPollInterval = 2
+
 // Config represents the main configuration structure
 type Config struct {
-	Applications        []AppConfig `json:"applications"`          // List of apps and their target resolutions
-	PollInterval        int         `json:"poll_interval"`         // Polling interval in seconds (default: 2)
-	ShowGUIOnLaunch     bool        `json:"show_gui_on_launch"`    // Show GUI window on launch (default: true)
-	StartWithWindows    bool        `json:"start_with_windows"`    // Start with Windows (default: false)
-	AutoStartMonitoring bool        `json:"auto_start_monitoring"` // Auto-start monitoring on launch (default: true)
+	Schema              string      `json:"$schema,omitempty"`                    // Optional: JSON Schema reference for editors, ignored by csres
+	Version             int         `json:"version"`                              // Config schema version (see CurrentConfigVersion)
+	Applications        []AppConfig `json:"applications"`                         // List of apps and their target resolutions
+	PollInterval        int         `json:"poll_interval" default:"2" min:"1"`    // Polling interval in seconds (default: 2)
+	ShowGUIOnLaunch     bool        `json:"show_gui_on_launch" default:"true"`    // Show GUI window on launch (default: true)
+	StartWithWindows    bool        `json:"start_with_windows" default:"false"`   // Start with Windows (default: false)
+	AutoStartMonitoring bool        `json:"auto_start_monitoring" default:"true"` // Auto-start monitoring on launch (default: true)
+	PersistResolution   bool        `json:"persist_resolution" default:"false"`   // Write resolution changes to the registry instead of temporary changes (default: false)
+	Profiles            []Profile   `json:"profiles,omitempty"`                   // Optional: named rule sets that replace applications while active
+	ActiveProfile       string      `json:"active_profile,omitempty"`             // Optional: name of the active profile, empty = top-level applications
+	HTTP                *HTTPConfig `json:"http,omitempty"`                       // Optional: dashboard and REST API, disabled when missing
+
+	source   string          // File the config was loaded from
+	document *configDocument // Parsed file, used to locate values in diagnostics
 }
 
-// LoadConfig loads configuration from a JSON file
+// LoadConfig loads and validates configuration from a JSON, YAML or TOML file,
+// chosen by its extension, merged with its conf.d and per-user layers. Main files
+// written for an older schema version are migrated in memory, the file itself is
+// only rewritten by UpgradeConfigFile.
 func LoadConfig(filename string) (*Config, error) {
+	return loadConfig(filename, true)
+}
+
+// loadConfig loads a main config file merged with its conf.d layers and, if
+// withUserLayer is set, the per-user override file
+func loadConfig(filename string, withUserLayer bool) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	doc, err := parseConfigDocument(filename, data)
+	if err != nil {
+		return nil, configFileError(filename, err)
+	}
+
+	version, err := configVersion(doc)
+	if err != nil {
+		return nil, configFileError(filename, err)
+	}
+	if version < CurrentConfigVersion {
+		if err := migrateConfigTree(doc.tree, version); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadConfigLayers(filename, doc, withUserLayer); err != nil {
+		return nil, err
+	}
+
+	return decodeConfig(filename, doc)
+}
+
+// configFileError wraps a single positioned issue into a *ConfigError
+func configFileError(filename string, err error) error {
+	var issue ConfigIssue
+	if errors.As(err, &issue) {
+		return &ConfigError{File: filename, Issues: []ConfigIssue{issue}}
+	}
+	return fmt.Errorf("failed to parse config %s: %w", configFormatOf(filename), err)
+}
+
+// decodeConfig decodes and validates a parsed config file. Problems are reported
+// as a *ConfigError with the line and column of each offending value.
+func decodeConfig(filename string, doc *configDocument) (*Config, error) {
+	// Reject unknown keys and values of the wrong type before decoding
+	if issues := doc.checkTree(doc.tree, reflect.TypeOf(Config{}), ""); len(issues) > 0 {
+		sortIssues(issues)
+		return nil, &ConfigError{File: filename, Issues: issues}
+	}
+
+	// Keys missing from the file get their documented default rather than the zero value
+	data, err := json.Marshal(withConfigDefaults(doc.tree, reflect.TypeOf(Config{})))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
 	}
 
-	// Set default values if not specified
-	if config.PollInterval <= 0 {
-		config.PollInterval = 2
+	if issues := doc.validateConfig(&config); len(issues) > 0 {
+		sortIssues(issues)
+		return nil, &ConfigError{File: filename, Issues: issues}
 	}
 
-	// Set defaults for new fields if this is an existing config file
-	// ShowGUIOnLaunch defaults to true if not set
-	// StartWithWindows defaults to false
-	// AutoStartMonitoring defaults to true
-
+	config.source = filename
+	config.document = doc
 	return &config, nil
 }
 
-// SaveConfig saves configuration to a JSON file (useful for creating default config)
+// withConfigDefaults returns a copy of a config tree in which every key that is
+// absent, as opposed to explicitly false or zero, is set to the value of its
+// field's `default` struct tag. Nested objects and lists are handled recursively.
+func withConfigDefaults(value any, typ reflect.Type) any {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+		result := make(map[string]any, len(obj))
+		for key, item := range obj {
+			result[key] = item
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			if item, set := result[name]; set {
+				result[name] = withConfigDefaults(item, field.Type)
+			} else if def, hasDefault := field.Tag.Lookup("default"); hasDefault {
+				result[name] = defaultValue(field.Type, def)
+			}
+		}
+		return result
+
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			return value
+		}
+		result := make([]any, len(items))
+		for i, item := range items {
+			result[i] = withConfigDefaults(item, typ.Elem())
+		}
+		return result
+	}
+
+	return value
+}
+
+// defaultValue converts a `default` struct tag to a config tree value
+func defaultValue(typ reflect.Type, def string) any {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return def == "true"
+	case reflect.String:
+		return def
+	}
+	return json.Number(def)
+}
+
+// SaveConfig saves configuration to a file in the format of its extension (useful
+// for creating default config)
 func SaveConfig(config *Config, filename string) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	// Saved files always use the current schema
+	config.Version = CurrentConfigVersion
+
+	data, err := encodeConfig(config, filename)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFormat is the file format of a config file, chosen by its extension
+type configFormat int
+
+const (
+	formatJSON configFormat = iota // .json and any unknown extension
+	formatYAML                     // .yaml, .yml
+	formatTOML                     // .toml
+)
+
+// configFormatOf returns the format of a config file based on its extension
+func configFormatOf(filename string) configFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	}
+	return formatJSON
+}
+
+func (f configFormat) String() string {
+	switch f {
+	case formatYAML:
+		return "YAML"
+	case formatTOML:
+		return "TOML"
+	}
+	return "JSON"
+}
+
+// parseConfigDocument parses config data in the format of the file into a generic
+// tree. Every format produces the same tree (objects, lists, strings, booleans and
+// json.Number values) so checking, defaults and validation are shared.
+func parseConfigDocument(filename string, data []byte) (*configDocument, error) {
+	switch configFormatOf(filename) {
+	case formatYAML:
+		return parseYAMLDocument(data)
+	case formatTOML:
+		return parseTOMLDocument(data)
+	}
+	return parseJSONDocument(data)
+}
+
+// floatNumber converts a float from a YAML or TOML file to a json.Number. Floats
+// with a whole value keep their decimal point, so 1280.0 is rejected where a whole
+// number is expected, as it is in a JSON file.
+func floatNumber(f float64) json.Number {
+	if f == math.Trunc(f) && !math.IsInf(f, 0) {
+		return json.Number(strconv.FormatFloat(f, 'f', 1, 64))
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// encodeConfig serializes a config in the format of the file it is written to.
+// YAML files keep the comments of the existing file where the keys still exist.
+func encodeConfig(config *Config, filename string) ([]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return encodeConfigJSON(data, filename)
+}
+
+// encodeConfigJSON converts JSON encoded config data to the format of the file
+func encodeConfigJSON(data []byte, filename string) ([]byte, error) {
+	switch configFormatOf(filename) {
+	case formatYAML:
+		return encodeYAMLConfig(data, filename)
+	case formatTOML:
+		return encodeTOMLConfig(data)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// configTree converts a config to a generic tree with json.Number values
+func configTree(config *Config) (map[string]any, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return decodeJSONTree(data)
+}
+
+// decodeJSONTree decodes JSON data into a generic tree with json.Number values
+func decodeJSONTree(data []byte) (map[string]any, error) {
+	var tree map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWholeNumberFieldsRejectFloats(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+	}{
+		{"config.json", `{"version": 2, "applications": [{"process_name": "cs2.exe", "resolution": {"width": 1280.0, "height": 960}}]}`},
+		{"config.yaml", "version: 2\napplications:\n  - process_name: cs2.exe\n    resolution:\n      width: 1280.0\n      height: 960\n"},
+		{"config.toml", "version = 2\n\n[[applications]]\nprocess_name = \"cs2.exe\"\nresolution = { width = 1280.0, height = 960 }\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			doc, err := parseConfigDocument(tt.file, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseConfigDocument: %v", err)
+			}
+
+			_, err = decodeConfig(tt.file, doc)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("decodeConfig() error = %v, want a *ConfigError", err)
+			}
+			if len(configErr.Issues) != 1 || !strings.Contains(configErr.Issues[0].Message, "whole number") {
+				t.Errorf("got issues %v, want one about the width not being a whole number", configErr.Issues)
+			}
+		})
+	}
+}
+
+func TestPollIntervalMinimum(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+	}{
+		{"config.json", `{"version": 2, "applications": [], "poll_interval": 0}`},
+		{"config.yaml", "version: 2\napplications: []\npoll_interval: -1\n"},
+		{"config.toml", "version = 2\napplications = []\npoll_interval = 0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			doc, err := parseConfigDocument(tt.file, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("parseConfigDocument: %v", err)
+			}
+
+			_, err = decodeConfig(tt.file, doc)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("decodeConfig() error = %v, want a *ConfigError", err)
+			}
+			if len(configErr.Issues) != 1 || configErr.Issues[0].Path != "poll_interval" || configErr.Issues[0].Pos.Line == 0 {
+				t.Errorf("got issues %v, want one positioned at poll_interval", configErr.Issues)
+			}
+		})
+	}
+}
+
+func TestFloatNumber(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{1280, "1280.0"},
+		{0, "0.0"},
+		{59.94, "59.94"},
+		{1e21, "1000000000000000000000.0"},
+	}
+
+	for _, tt := range tests {
+		if got := floatNumber(tt.value); got.String() != tt.want {
+			t.Errorf("floatNumber(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configDropInDirName is the directory next to the main config file whose config
+// files are merged over it, e.g. conf.d/10-team-games.yaml
+const configDropInDirName = "conf.d"
+
+// configExtensions lists the file extensions recognised as config layers
+var configExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// isConfigExtension reports whether a file name has a config file extension
+func isConfigExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, configExt := range configExtensions {
+		if ext == configExt {
+			return true
+		}
+	}
+	return false
+}
+
+// configDropInDir returns the drop-in directory of a main config file
+func configDropInDir(filename string) string {
+	return filepath.Join(filepath.Dir(filename), configDropInDirName)
+}
+
+// userConfigCandidates returns the possible per-user override files of a main
+// config file, e.g. config.user.json, config.user.yaml, ...
+func userConfigCandidates(filename string) []string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".user"
+	candidates := []string{base + filepath.Ext(filename)}
+	for _, ext := range configExtensions {
+		if !strings.EqualFold(ext, filepath.Ext(filename)) {
+			candidates = append(candidates, base+ext)
+		}
+	}
+	return candidates
+}
+
+// userConfigPath returns the per-user override file of a main config file. An
+// existing file in any format is used, otherwise it gets the main file's format.
+func userConfigPath(filename string) string {
+	candidates := userConfigCandidates(filename)
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+// configOverlayFiles returns the existing layers above the main config file in
+// merge order: conf.d fragments by name, then the per-user file if withUserLayer is set
+func configOverlayFiles(filename string, withUserLayer bool) ([]string, error) {
+	var files []string
+
+	entries, err := os.ReadDir(configDropInDir(filename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !isConfigExtension(name) {
+			continue
+		}
+		files = append(files, filepath.Join(configDropInDir(filename), name))
+	}
+	sort.Strings(files)
+
+	if withUserLayer {
+		userFile := userConfigPath(filename)
+		if _, err := os.Stat(userFile); err == nil {
+			files = append(files, userFile)
+		}
+	}
+
+	return files, nil
+}
+
+// ConfigLayerFiles returns every existing file that makes up a config, starting
+// with the main file
+func ConfigLayerFiles(filename string) []string {
+	files, err := configOverlayFiles(filename, true)
+	if err != nil {
+		return []string{filename}
+	}
+	return append([]string{filename}, files...)
+}
+
+// loadConfigLayers merges the overlay layers of a main config file into its
+// parsed document. Layers are merged in this order, later layers win:
+//
+//  1. the main config file, e.g. config.json
+//  2. every config file in the conf.d directory next to it, in file name order
+//  3. the per-user override file, e.g. config.user.json
+//
+// Objects are merged key by key. Lists of applications are merged by process_name
+// and profiles by name, so a layer can add rules or change part of an inherited
+// rule. Any other list is replaced as a whole.
+func loadConfigLayers(filename string, doc *configDocument, withUserLayer bool) error {
+	files, err := configOverlayFiles(filename, withUserLayer)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		layer, err := parseConfigDocument(file, data)
+		if err != nil {
+			return configFileError(file, err)
+		}
+
+		// Only the main file is versioned and migrated, layers have to use the current schema
+		version, err := configVersion(layer)
+		if err != nil {
+			return configFileError(file, err)
+		}
+		if _, versioned := layer.tree["version"]; versioned && version < CurrentConfigVersion {
+			return &ConfigError{File: file, Issues: []ConfigIssue{layer.issue("version", "config layers must use version %d", CurrentConfigVersion)}}
+		}
+		delete(layer.tree, "version")
+
+		// Merging would silently combine rules or profiles that share their name
+		if issues := layer.duplicateListItems(layer.tree, ""); len(issues) > 0 {
+			sortIssues(issues)
+			return &ConfigError{File: file, Issues: issues}
+		}
+
+		doc.mergeLayer(layer, file)
+	}
+
+	return nil
+}
+
+// duplicateListItems reports items of merged lists (rules and profiles) at or below
+// path p that share their identifying key with an earlier item of the same list
+func (doc *configDocument) duplicateListItems(value any, p string) []ConfigIssue {
+	var issues []ConfigIssue
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			issues = append(issues, doc.duplicateListItems(item, joinConfigPath(p, key))...)
+		}
+
+	case []any:
+		key := configListKey(p)
+		seen := make(map[string]int)
+		for i, item := range v {
+			itemPath := fmt.Sprintf("%s[%d]", p, i)
+			issues = append(issues, doc.duplicateListItems(item, itemPath)...)
+
+			name := configListItemKey(item, key)
+			if key == "" || name == "" {
+				continue
+			}
+			first, duplicate := seen[name]
+			if !duplicate {
+				seen[name] = i
+				continue
+			}
+			original := item.(map[string]any)[key]
+			if key == "process_name" {
+				issues = append(issues, doc.issue(joinConfigPath(itemPath, key), "duplicate rule for %q, already defined by %s[%d]", original, p, first))
+			} else {
+				issues = append(issues, doc.issue(joinConfigPath(itemPath, key), "duplicate profile %q, already defined by %s[%d]", original, p, first))
+			}
+		}
+	}
+	return issues
+}
+
+// mergeLayer merges an overlay document into doc, keeping track of which file
+// every merged value came from for diagnostics
+func (doc *configDocument) mergeLayer(layer *configDocument, file string) {
+	if doc.files == nil {
+		doc.files = make(map[string]string)
+	}
+	doc.tree = doc.mergeValue(doc.tree, layer.tree, "", "", layer, file).(map[string]any)
+}
+
+// mergeValue merges src from layer at srcPath into dst at dstPath and returns the result
+func (doc *configDocument) mergeValue(dst, src any, dstPath, srcPath string, layer *configDocument, file string) any {
+	switch value := src.(type) {
+	case map[string]any:
+		obj, ok := dst.(map[string]any)
+		if !ok {
+			break
+		}
+		for key, item := range value {
+			obj[key] = doc.mergeValue(obj[key], item, joinConfigPath(dstPath, key), joinConfigPath(srcPath, key), layer, file)
+		}
+		return obj
+
+	case []any:
+		items, ok := dst.([]any)
+		key := configListKey(dstPath)
+		if !ok || key == "" {
+			break
+		}
+
+		index := make(map[string]int)
+		for i, item := range items {
+			if name := configListItemKey(item, key); name != "" {
+				index[name] = i
+			}
+		}
+		for i, item := range value {
+			itemPath := fmt.Sprintf("%s[%d]", srcPath, i)
+			name := configListItemKey(item, key)
+			if existing, exists := index[name]; name != "" && exists {
+				items[existing] = doc.mergeValue(items[existing], item, fmt.Sprintf("%s[%d]", dstPath, existing), itemPath, layer, file)
+				continue
+			}
+			items = append(items, item)
+			doc.copyPositions(layer, itemPath, fmt.Sprintf("%s[%d]", dstPath, len(items)-1), file)
+			if name != "" {
+				index[name] = len(items) - 1
+			}
+		}
+		return items
+	}
+
+	// Scalars, new values and values that can't be merged replace what was there
+	doc.copyPositions(layer, srcPath, dstPath, file)
+	return src
+}
+
+// copyPositions records the positions of a layer value and everything nested in
+// it under their path in the merged document
+func (doc *configDocument) copyPositions(layer *configDocument, srcPath, dstPath, file string) {
+	for p := range doc.positions {
+		if isConfigSubPath(p, dstPath) {
+			delete(doc.positions, p)
+			delete(doc.files, p)
+		}
+	}
+	for p, pos := range layer.positions {
+		if isConfigSubPath(p, srcPath) {
+			merged := dstPath + strings.TrimPrefix(p, srcPath)
+			doc.positions[merged] = pos
+			doc.files[merged] = file
+		}
+	}
+}
+
+// isConfigSubPath reports whether p is parent or a value nested in it
+func isConfigSubPath(p, parent string) bool {
+	if parent == "" || p == parent {
+		return true
+	}
+	return strings.HasPrefix(p, parent) && (p[len(parent)] == '.' || p[len(parent)] == '[')
+}
+
+// configListKey returns the key that identifies items of the list at p, or ""
+// for lists that are replaced as a whole
+func configListKey(p string) string {
+	name := p
+	if idx := strings.LastIndex(p, "."); idx != -1 {
+		name = p[idx+1:]
+	}
+	switch name {
+	case "applications":
+		return "process_name"
+	case "profiles":
+		return "name"
+	}
+	return ""
+}
+
+// configListItemKey returns the lower-cased identifying value of a list item
+func configListItemKey(item any, key string) string {
+	obj, ok := item.(map[string]any)
+	if !ok {
+		return ""
+	}
+	name, _ := obj[key].(string)
+	return strings.ToLower(name)
+}
+
+// SaveUserConfig writes the settings of config that differ from the main file
+// and conf.d layers to the per-user override file. Rules and profiles that were
+// removed are written as disabled and optional settings that were removed as
+// null, since a layer can't delete what it inherits.
+func SaveUserConfig(config *Config) error {
+	if config.source == "" {
+		return fmt.Errorf("config was not loaded from a file")
+	}
+
+	lower, err := loadConfig(config.source, false)
+	if err != nil {
+		return err
+	}
+	lowerTree, err := configTree(lower)
+	if err != nil {
+		return err
+	}
+	desiredTree, err := configTree(config)
+	if err != nil {
+		return err
+	}
+
+	overrides, _ := configTreeDiff(lowerTree, desiredTree, "")
+	tree, _ := overrides.(map[string]any)
+	if tree == nil {
+		tree = make(map[string]any)
+	}
+	delete(tree, "version")
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	userFile := userConfigPath(config.source)
+	if p := configNullPath(tree, ""); p != "" && configFormatOf(userFile) == formatTOML {
+		return fmt.Errorf("can't remove %s in %s, TOML has no null value; use a JSON or YAML file for per-user settings", p, userFile)
+	}
+	data, err = encodeConfigJSON(data, userFile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.WriteFile(userFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// configTreeDiff returns what an overlay has to contain so that merging it over
+// lower produces desired, and whether anything differs at all
+func configTreeDiff(lower, desired any, p string) (any, bool) {
+	switch value := desired.(type) {
+	case map[string]any:
+		obj, ok := lower.(map[string]any)
+		if !ok {
+			return value, true
+		}
+
+		diff := make(map[string]any)
+		for key, item := range value {
+			if itemDiff, changed := configTreeDiff(obj[key], item, joinConfigPath(p, key)); changed {
+				diff[key] = itemDiff
+			}
+		}
+		// Optional values are left out when empty, so one that disappeared was reset
+		for key, item := range obj {
+			if _, exists := value[key]; exists {
+				continue
+			}
+			if itemDiff, changed := configTreeDiff(item, emptyConfigValue(item), joinConfigPath(p, key)); changed {
+				diff[key] = itemDiff
+			}
+		}
+
+		if len(diff) == 0 {
+			return nil, false
+		}
+		return diff, true
+
+	case []any:
+		items, ok := lower.([]any)
+		key := configListKey(p)
+		if !ok || key == "" {
+			return value, !reflect.DeepEqual(lower, desired)
+		}
+
+		lowerItems := make(map[string]any)
+		for _, item := range items {
+			lowerItems[configListItemKey(item, key)] = item
+		}
+
+		var diff []any
+		kept := make(map[string]bool)
+		for i, item := range value {
+			name := configListItemKey(item, key)
+			kept[name] = true
+			itemDiff, changed := configTreeDiff(lowerItems[name], item, fmt.Sprintf("%s[%d]", p, i))
+			if !changed {
+				continue
+			}
+			// Changed items keep their identifying key so the merge can find them
+			if obj, ok := itemDiff.(map[string]any); ok {
+				obj[key] = item.(map[string]any)[key]
+			}
+			diff = append(diff, itemDiff)
+		}
+
+		// Rules and profiles that were removed are disabled
+		for _, item := range items {
+			obj, _ := item.(map[string]any)
+			if kept[configListItemKey(item, key)] || obj["disabled"] == true {
+				continue
+			}
+			diff = append(diff, map[string]any{key: obj[key], "disabled": true})
+		}
+
+		if len(diff) == 0 {
+			return nil, false
+		}
+		return diff, true
+	}
+
+	return desired, !reflect.DeepEqual(lower, desired)
+}
+
+// emptyConfigValue returns the value an omitted key of the same kind as value
+// stands for: false, "", 0, an empty list or null
+func emptyConfigValue(value any) any {
+	switch value.(type) {
+	case bool:
+		return false
+	case string:
+		return ""
+	case json.Number:
+		return json.Number("0")
+	case []any:
+		return []any{}
+	}
+	return nil
+}
+
+// configNullPath returns the path of the first null value in an overlay tree, or ""
+func configNullPath(value any, p string) string {
+	switch v := value.(type) {
+	case nil:
+		return p
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if found := configNullPath(v[key], joinConfigPath(p, key)); found != "" {
+				return found
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if found := configNullPath(item, fmt.Sprintf("%s[%d]", p, i)); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
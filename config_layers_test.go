@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// layeredConfig is a main config file with a rule that has a restore resolution,
+// a profile and dashboard settings, all of which an override can remove
+const layeredConfig = `{
+  "version": 2,
+  "applications": [
+    {
+      "process_name": "cs2.exe",
+      "resolution": {"width": 1280, "height": 960},
+      "monitor_name": "",
+      "restore_resolution": {"width": 2560, "height": 1440}
+    },
+    {
+      "process_name": "valorant.exe",
+      "resolution": {"width": 1920, "height": 1080},
+      "monitor_name": ""
+    }
+  ],
+  "profiles": [
+    {"name": "streaming", "applications": []},
+    {"name": "competitive", "applications": []}
+  ],
+  "active_profile": "competitive",
+  "http": {"address": "127.0.0.1:8765"}
+}`
+
+// writeLayeredConfig writes the main config file to a temporary directory
+func writeLayeredConfig(t *testing.T, name string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(configPath, []byte(layeredConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestSaveUserConfigRemovals(t *testing.T) {
+	configPath := writeLayeredConfig(t, "config.json")
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	// Remove what the main file sets, as the GUI does
+	config.Applications[0].RestoreResolution = nil
+	config.Applications = config.Applications[:1]
+	config.Profiles = config.Profiles[1:]
+	config.ActiveProfile = ""
+	config.HTTP = nil
+	if err := SaveUserConfig(config); err != nil {
+		t.Fatalf("SaveUserConfig: %v", err)
+	}
+
+	reloaded, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loading the saved override: %v", err)
+	}
+	if rules := reloaded.Rules(); len(rules) != 2 || !rules[1].Disabled {
+		t.Errorf("got rules %+v, want valorant.exe disabled", rules)
+	}
+	if restore := reloaded.Applications[0].RestoreResolution; restore != nil {
+		t.Errorf("restore_resolution is %+v, want it removed", *restore)
+	}
+	if names := reloaded.ProfileNames(); len(names) != 1 || names[0] != "competitive" {
+		t.Errorf("got profiles %v, want only competitive", names)
+	}
+	if reloaded.ActiveProfile != "" {
+		t.Errorf("active_profile is %q, want the top-level rules", reloaded.ActiveProfile)
+	}
+	if reloaded.HTTP != nil {
+		t.Errorf("http is %+v, want it removed", *reloaded.HTTP)
+	}
+
+	// Saving the reloaded config again keeps the removals
+	if err := SaveUserConfig(reloaded); err != nil {
+		t.Fatalf("second SaveUserConfig: %v", err)
+	}
+	again, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loading the override saved twice: %v", err)
+	}
+	if again.Profile("streaming") != nil || again.HTTP != nil || again.Applications[0].RestoreResolution != nil {
+		t.Error("removals were lost when the override was saved again")
+	}
+}
+
+func TestSaveUserConfigTOMLNull(t *testing.T) {
+	configPath := writeLayeredConfig(t, "config.json")
+	if err := os.WriteFile(filepath.Join(filepath.Dir(configPath), "config.user.toml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	config.HTTP = nil
+	err = SaveUserConfig(config)
+	if err == nil || !strings.Contains(err.Error(), "http") {
+		t.Errorf("SaveUserConfig() = %v, want an error about removing http", err)
+	}
+}
+
+func TestDropInDuplicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		want     string
+	}{
+		{
+			name:     "rules",
+			fragment: `{"applications": [{"process_name": "cs2.exe", "resolution": {"width": 1024, "height": 768}}, {"process_name": "CS2.exe", "disabled": true}]}`,
+			want:     `duplicate rule for "CS2.exe", already defined by applications[0]`,
+		},
+		{
+			name:     "profile rules",
+			fragment: `{"profiles": [{"name": "streaming", "applications": [{"process_name": "obs64.exe", "disabled": true}, {"process_name": "obs64.exe", "disabled": true}]}]}`,
+			want:     `duplicate rule for "obs64.exe", already defined by profiles[0].applications[0]`,
+		},
+		{
+			name:     "profiles",
+			fragment: `{"profiles": [{"name": "lan"}, {"name": "LAN"}]}`,
+			want:     `duplicate profile "LAN", already defined by profiles[0]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := writeLayeredConfig(t, "config.json")
+			dropInDir := configDropInDir(configPath)
+			if err := os.Mkdir(dropInDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			fragment := filepath.Join(dropInDir, "10-team.json")
+			if err := os.WriteFile(fragment, []byte(tt.fragment), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadConfig(configPath)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("LoadConfig() error = %v, want a *ConfigError", err)
+			}
+			if configErr.File != fragment || len(configErr.Issues) != 1 || configErr.Issues[0].Message != tt.want {
+				t.Errorf("got %s: %v, want %s: %s", configErr.File, configErr.Issues, fragment, tt.want)
+			}
+		})
+	}
+}
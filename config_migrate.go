@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CurrentConfigVersion is the config schema version written by this build
+const CurrentConfigVersion = 2
+
+// configMigration upgrades a config tree from one schema version to the next
+type configMigration struct {
+	from        int
+	description string
+	migrate     func(tree map[string]any) error
+}
+
+// configMigrations lists every upgrade step in order. Version history:
+//
+//	0: top-level default_resolution and default_monitor (no version field)
+//	1: per-application restore_resolution, defaults removed (no version field)
+//	2: explicit version field, settings written out explicitly, poll_interval of at least 1
+var configMigrations = []configMigration{
+	{from: 0, description: "move default_monitor and default_resolution into each application", migrate: migrateConfigV0},
+	{from: 1, description: "add version field and explicit settings", migrate: migrateConfigV1},
+}
+
+// configVersion returns the schema version of a config tree. Files written before
+// the version field existed are identified by the keys they contain.
+func configVersion(doc *configDocument) (int, error) {
+	value, exists := doc.tree["version"]
+	if !exists {
+		if _, legacy := doc.tree["default_monitor"]; legacy {
+			return 0, nil
+		}
+		if _, legacy := doc.tree["default_resolution"]; legacy {
+			return 0, nil
+		}
+		return 1, nil
+	}
+
+	number, ok := value.(json.Number)
+	version, err := strconv.Atoi(number.String())
+	if !ok || err != nil || version < 0 {
+		return 0, doc.issue("version", "version must be a non-negative whole number")
+	}
+	if version > CurrentConfigVersion {
+		return 0, doc.issue("version", "config version %d is newer than this build supports (%d), please update csres", version, CurrentConfigVersion)
+	}
+	return version, nil
+}
+
+// migrateConfigTree upgrades a config tree step by step to CurrentConfigVersion
+func migrateConfigTree(tree map[string]any, from int) error {
+	for _, migration := range configMigrations {
+		if migration.from < from {
+			continue
+		}
+		if err := migration.migrate(tree); err != nil {
+			return fmt.Errorf("failed to migrate config from version %d: %w", migration.from, err)
+		}
+		tree["version"] = json.Number(strconv.Itoa(migration.from + 1))
+		debugf("Config migrated from version %d to %d: %s", migration.from, migration.from+1, migration.description)
+	}
+	return nil
+}
+
+// migrateConfigV0 moves the global default monitor and resolution into the
+// applications that relied on them
+func migrateConfigV0(tree map[string]any) error {
+	defaultMonitor, _ := tree["default_monitor"].(string)
+	defaultResolution, _ := tree["default_resolution"].(map[string]any)
+	delete(tree, "default_monitor")
+	delete(tree, "default_resolution")
+
+	apps, _ := tree["applications"].([]any)
+	for _, item := range apps {
+		app, ok := item.(map[string]any)
+		if !ok {
+			continue // Left for validation to report
+		}
+
+		// An empty monitor name used to mean the default monitor
+		if monitorName, _ := app["monitor_name"].(string); monitorName == "" && defaultMonitor != "" {
+			app["monitor_name"] = defaultMonitor
+		}
+
+		// The default resolution was restored when no application was running
+		if _, exists := app["restore_resolution"]; !exists && defaultResolution != nil {
+			restore := make(map[string]any, len(defaultResolution))
+			for key, value := range defaultResolution {
+				restore[key] = value
+			}
+			app["restore_resolution"] = restore
+		}
+	}
+
+	return nil
+}
+
+// migrateConfigV1 writes out the settings that version 1 files left to their
+// defaults, so an absent key isn't read back as false. Those releases also used
+// the default poll_interval for values below 1 second, which are rejected now.
+func migrateConfigV1(tree map[string]any) error {
+	for _, key := range []string{"show_gui_on_launch", "auto_start_monitoring"} {
+		if _, exists := tree[key]; !exists {
+			tree[key] = true
+		}
+	}
+
+	if number, ok := tree["poll_interval"].(json.Number); ok {
+		if interval, err := number.Int64(); err == nil && interval < 1 {
+			tree["poll_interval"] = json.Number(strconv.Itoa(defaultPollInterval))
+		}
+	}
+	return nil
+}
+
+// configBackupPath returns where UpgradeConfigFile keeps the original of a file
+// written for an older schema version
+func configBackupPath(filename string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", filename, version)
+}
+
+// UpgradeConfigFile rewrites a config file written for an older schema version in
+// the current one, keeping the original as <file>.v<version>.bak. It returns the
+// version the file had; files that are already current are left untouched.
+//
+// Only the file itself is migrated. When conf.d fragments or a per-user file are
+// layered on top of it, they may have been written against the old version, so
+// the file is left alone unless force is set; it is still migrated in memory
+// whenever it is loaded.
+func UpgradeConfigFile(filename string, force bool) (int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	doc, err := parseConfigDocument(filename, data)
+	if err != nil {
+		return 0, configFileError(filename, err)
+	}
+	from, err := configVersion(doc)
+	if err != nil {
+		return 0, configFileError(filename, err)
+	}
+	if from == CurrentConfigVersion {
+		return from, nil
+	}
+	if layers := ConfigLayerFiles(filename)[1:]; len(layers) > 0 && !force {
+		return from, fmt.Errorf("%s is version %d and is read as if it were upgraded; it is not rewritten because %s are layered on top of it, use csres config migrate --force to rewrite it anyway", filename, from, strings.Join(layers, ", "))
+	}
+
+	if err := migrateConfigTree(doc.tree, from); err != nil {
+		return 0, err
+	}
+
+	migratedData, err := json.Marshal(doc.tree)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode migrated config: %w", err)
+	}
+	migratedDoc, err := parseJSONDocument(migratedData)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse migrated config: %w", err)
+	}
+	config, err := decodeConfig(filename, migratedDoc)
+	if err != nil {
+		return 0, fmt.Errorf("config could not be migrated from version %d: %w", from, err)
+	}
+
+	backupPath := configBackupPath(filename, from)
+	if err := os.WriteFile(backupPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to back up config before migration: %w", err)
+	}
+
+	if err := SaveConfig(config, filename); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Config %s upgraded from version %d to %d, original saved as %s", filename, from, CurrentConfigVersion, backupPath)
+	return from, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// migrationFixtures are config files written by older releases, each with a
+// <name>.want.json next to it holding the same config in the current version
+var migrationFixtures = []struct {
+	file    string
+	version int
+}{
+	{"v0.json", 0},
+	{"v1.json", 1},
+	// Releases before version 2 used the default for a poll_interval below 1 second
+	{"v1-poll-interval.json", 1},
+}
+
+// copyFixture copies a file from testdata/config to a temporary directory
+func copyFixture(t *testing.T, name string) (string, []byte) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "config", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// loadWantedConfig loads the current version of a migration fixture
+func loadWantedConfig(t *testing.T, name string) *Config {
+	t.Helper()
+	wantFile := name[:len(name)-len(filepath.Ext(name))] + ".want.json"
+	want, err := loadConfig(filepath.Join("testdata", "config", wantFile), false)
+	if err != nil {
+		t.Fatalf("loading %s: %v", wantFile, err)
+	}
+	return want
+}
+
+// assertSameConfig compares two configs, ignoring where they were loaded from
+func assertSameConfig(t *testing.T, got, want *Config) {
+	t.Helper()
+	gotCopy, wantCopy := *got, *want
+	gotCopy.source, gotCopy.document = "", nil
+	wantCopy.source, wantCopy.document = "", nil
+	if !reflect.DeepEqual(gotCopy, wantCopy) {
+		t.Errorf("migrated config is\n%+v\nwant\n%+v", gotCopy, wantCopy)
+	}
+}
+
+func TestUpgradeConfigFile(t *testing.T) {
+	for _, tt := range migrationFixtures {
+		t.Run(tt.file, func(t *testing.T) {
+			path, original := copyFixture(t, tt.file)
+
+			from, err := UpgradeConfigFile(path, false)
+			if err != nil {
+				t.Fatalf("UpgradeConfigFile: %v", err)
+			}
+			if from != tt.version {
+				t.Errorf("UpgradeConfigFile returned version %d, want %d", from, tt.version)
+			}
+
+			// The original is kept byte for byte
+			backup, err := os.ReadFile(configBackupPath(path, tt.version))
+			if err != nil {
+				t.Fatalf("reading backup: %v", err)
+			}
+			if !bytes.Equal(backup, original) {
+				t.Error("backup differs from the original file")
+			}
+
+			got, err := loadConfig(path, false)
+			if err != nil {
+				t.Fatalf("loading upgraded file: %v", err)
+			}
+			if got.Version != CurrentConfigVersion {
+				t.Errorf("upgraded file has version %d, want %d", got.Version, CurrentConfigVersion)
+			}
+			assertSameConfig(t, got, loadWantedConfig(t, tt.file))
+
+			// An upgraded file is left alone
+			upgraded, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, err = UpgradeConfigFile(path, false)
+			if err != nil || from != CurrentConfigVersion {
+				t.Fatalf("second UpgradeConfigFile = %d, %v; want %d, nil", from, err, CurrentConfigVersion)
+			}
+			if again, _ := os.ReadFile(path); !bytes.Equal(again, upgraded) {
+				t.Error("second UpgradeConfigFile rewrote the file")
+			}
+		})
+	}
+}
+
+func TestUpgradeConfigFileWithLayers(t *testing.T) {
+	path, original := copyFixture(t, "v0.json")
+	writeTestFile(t, userConfigPath(path), []byte(`{"poll_interval": 5}`))
+
+	// The user file was written for the old version too, the base is only rewritten on request
+	if _, err := UpgradeConfigFile(path, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("UpgradeConfigFile = %v, want an error pointing to --force", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, original) {
+		t.Error("UpgradeConfigFile rewrote a file other layers depend on")
+	}
+
+	from, err := UpgradeConfigFile(path, true)
+	if err != nil || from != 0 {
+		t.Fatalf("UpgradeConfigFile with force = %d, %v; want 0, nil", from, err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != CurrentConfigVersion || config.PollInterval != 5 {
+		t.Errorf("got version %d and poll_interval %d, want %d and the user layer's 5", config.Version, config.PollInterval, CurrentConfigVersion)
+	}
+}
+
+func TestLoadConfigMigratesInMemory(t *testing.T) {
+	for _, tt := range migrationFixtures {
+		t.Run(tt.file, func(t *testing.T) {
+			path, original := copyFixture(t, tt.file)
+
+			got, err := loadConfig(path, false)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			assertSameConfig(t, got, loadWantedConfig(t, tt.file))
+
+			// Loading must not touch the file or leave a backup behind
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, original) {
+				t.Error("loadConfig rewrote the file")
+			}
+			if _, err := os.Stat(configBackupPath(path, tt.version)); !os.IsNotExist(err) {
+				t.Errorf("loadConfig created a backup (stat: %v)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ConfigEnvVar names the environment variable that points to the config file
+	ConfigEnvVar = "CSRES_CONFIG"
+
+	// configDirName is the directory created in the user config directory
+	// (%APPDATA% on Windows, $XDG_CONFIG_HOME or ~/.config on Linux)
+	configDirName = "csres"
+)
+
+// configFileNames lists the main config file names looked for in a directory, in order
+var configFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// ResolveConfigPath decides which config file to use. The search order is:
+//
+//  1. the path given on the command line
+//  2. the CSRES_CONFIG environment variable
+//  3. the csres directory in the user config directory
+//  4. the directory of the executable
+//
+// If none of them has a config file, a config.json in the working directory is
+// copied to the user config directory. Otherwise the user config directory is
+// returned so a default config can be created there. The result is absolute and
+// is returned with a description of where it came from.
+func ResolveConfigPath(explicit string) (string, string, error) {
+	return resolveConfigPath(explicit, true)
+}
+
+// LocateConfigPath is ResolveConfigPath without copying a config from the working
+// directory, for diagnostics that must not change anything. Such a config is
+// returned where it is.
+func LocateConfigPath(explicit string) (string, string, error) {
+	return resolveConfigPath(explicit, false)
+}
+
+// resolveConfigPath implements ResolveConfigPath, copying a legacy config only if
+// migrate is set
+func resolveConfigPath(explicit string, migrate bool) (string, string, error) {
+	if explicit != "" {
+		path, err := filepath.Abs(explicit)
+		return path, "command line", err
+	}
+
+	if env := os.Getenv(ConfigEnvVar); env != "" {
+		path, err := filepath.Abs(env)
+		return path, ConfigEnvVar + " environment variable", err
+	}
+
+	userDir, userDirErr := userConfigDir()
+	if userDirErr == nil {
+		if path, found := findConfigFile(userDir); found {
+			return path, "user config directory", nil
+		}
+	}
+
+	if exePath, err := os.Executable(); err == nil {
+		if path, found := findConfigFile(filepath.Dir(exePath)); found {
+			return path, "next to the executable", nil
+		}
+	}
+
+	if userDirErr != nil {
+		return "", "", fmt.Errorf("failed to find user config directory: %w", userDirErr)
+	}
+
+	// Configs used to be read from the working directory, copy them to the new location
+	if legacyPath, err := filepath.Abs(DefaultConfigFile); err == nil {
+		if _, err := os.Stat(legacyPath); err == nil {
+			if !migrate {
+				return legacyPath, "working directory, not copied to the user config directory yet", nil
+			}
+			path, err := migrateLegacyConfig(legacyPath, userDir)
+			if err != nil {
+				return "", "", err
+			}
+			return path, "copied from the working directory", nil
+		}
+	}
+
+	return filepath.Join(userDir, DefaultConfigFile), "default location", nil
+}
+
+// userConfigDir returns the csres directory in the user config directory
+func userConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName), nil
+}
+
+// findConfigFile looks for a main config file in a directory
+func findConfigFile(dir string) (string, bool) {
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// migrateLegacyConfig copies a config from the working directory, together with
+// its conf.d and per-user layers, to the user config directory. The originals are
+// left in place but are no longer read.
+func migrateLegacyConfig(legacyPath, userDir string) (string, error) {
+	legacyDir := filepath.Dir(legacyPath)
+	for _, file := range ConfigLayerFiles(legacyPath) {
+		rel, err := filepath.Rel(legacyDir, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to migrate config file: %w", err)
+		}
+
+		target := filepath.Join(userDir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", fmt.Errorf("failed to create config directory: %w", err)
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return "", fmt.Errorf("failed to migrate config file: %w", err)
+		}
+		log.Printf("Copied %s to %s", file, target)
+	}
+
+	log.Printf("Config copied to %s, the originals in %s are left in place but no longer used", userDir, legacyDir)
+	return filepath.Join(userDir, filepath.Base(legacyPath)), nil
+}
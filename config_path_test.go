@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocateConfigPathDoesNotCopy(t *testing.T) {
+	// A config left in the working directory by an older release
+	workDir := t.TempDir()
+	t.Chdir(workDir)
+	writeTestFile(t, filepath.Join(workDir, DefaultConfigFile), testConfig(2))
+
+	userDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	t.Setenv("HOME", userDir)
+	t.Setenv("APPDATA", userDir)
+	t.Setenv(ConfigEnvVar, "")
+
+	path, _, err := LocateConfigPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(workDir, DefaultConfigFile); path != want {
+		t.Errorf("got %s, want the config in the working directory %s", path, want)
+	}
+	entries, err := os.ReadDir(userDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("LocateConfigPath created %s in the user config directory", entries[0].Name())
+	}
+}
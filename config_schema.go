@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// configSchemaID is the JSON Schema dialect of the generated schema. Draft 7 is
+// the newest draft understood by VS Code's JSON language support.
+const configSchemaID = "http://json-schema.org/draft-07/schema#"
+
+// configFieldDescriptions documents every config key for the JSON Schema, keyed
+// by Go type name and JSON key
+var configFieldDescriptions = map[string]string{
+	"Config.$schema":               "JSON Schema used by editors for completion and validation. Ignored by csres.",
+	"Config.version":               "Schema version of this file. Older files are migrated automatically.",
+	"Config.applications":          "Applications to monitor and the resolution to use while they run.",
+	"Config.poll_interval":         "How often to check for running applications, in seconds.",
+	"Config.show_gui_on_launch":    "Show the main window on launch.",
+	"Config.start_with_windows":    "Start csres when you log in to Windows.",
+	"Config.auto_start_monitoring": "Start monitoring as soon as csres launches.",
+	"Config.persist_resolution":    "Write resolution changes to the registry so they survive logoff and driver resets, instead of temporary changes that Windows reverts if csres exits.",
+	"Config.profiles":              "Named rule sets. While a profile is active its applications replace the top-level list.",
+	"Config.active_profile":        "Name of the active profile. Empty uses the top-level applications.",
+	"Config.http":                  "Dashboard and REST API served over HTTP. Read on launch, restart csres after changing it.",
+
+	"AppConfig.process_name":       "Executable name of the application, e.g. cs2.exe. Matched case-insensitively.",
+	"AppConfig.resolution":         "Resolution to switch to while the application runs.",
+	"AppConfig.monitor_name":       "Monitor to change. Empty for the primary monitor, a device name like \\\\.\\DISPLAY1, or a stable identifier: id:<DeviceID>, edid:<manufacturer+product>[:<serial>] or name:<pattern>.",
+	"AppConfig.restore_resolution": "Resolution to restore when the application closes. Defaults to the resolution the monitor had before.",
+	"AppConfig.disabled":           "Switches off a rule inherited from another config file.",
+
+	"Profile.name":               "Name of the profile, used by active_profile and --profile.",
+	"Profile.applications":       "Applications to monitor while this profile is active.",
+	"Profile.poll_interval":      "Overrides poll_interval while this profile is active.",
+	"Profile.persist_resolution": "Overrides persist_resolution while this profile is active.",
+	"Profile.disabled":           "Removes a profile inherited from another config file.",
+
+	"HTTPConfig.address": "Address to listen on, e.g. 127.0.0.1:8765. Use 0.0.0.0:8765 to allow other computers, which requires a token.",
+	"HTTPConfig.token":   "Token clients have to send in the Authorization header (Bearer <token>). Required unless the address is a loopback address.",
+
+	"Resolution.width":     "Width in pixels.",
+	"Resolution.height":    "Height in pixels.",
+	"Resolution.frequency": "Refresh rate in Hz. Omit or use 0 to keep the current rate.",
+}
+
+// configRequiredFields lists the keys that have to be present, keyed by Go type name
+var configRequiredFields = map[string][]string{
+	"AppConfig":  {"process_name"},
+	"HTTPConfig": {"address"},
+	"Profile":    {"name"},
+	"Resolution": {"width", "height"},
+}
+
+// ConfigSchema generates a JSON Schema for the config file from the Config type.
+// Defaults come from the `default` struct tags and lower bounds from `min` tags,
+// the same tags that are used when a config is loaded.
+func ConfigSchema() map[string]any {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = configSchemaID
+	schema["title"] = "CS Resolution Monitor configuration"
+
+	// The version is limited to the ones this build can read
+	properties := schema["properties"].(map[string]any)
+	version := properties["version"].(map[string]any)
+	version["minimum"] = 0
+	version["maximum"] = CurrentConfigVersion
+
+	return schema
+}
+
+// ConfigSchemaJSON returns the JSON Schema for the config file as indented JSON
+func ConfigSchemaJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // Descriptions contain placeholders like <serial>
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ConfigSchema()); err != nil {
+		return nil, fmt.Errorf("failed to marshal config schema: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// typeSchema returns the JSON Schema of a config type
+func typeSchema(typ reflect.Type) map[string]any {
+	// Optional values may be null, which removes them in an override file
+	if typ.Kind() == reflect.Pointer {
+		schema := typeSchema(typ.Elem())
+		schema["type"] = []any{schema["type"], "null"}
+		return schema
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+
+			property := typeSchema(field.Type)
+			if description, exists := configFieldDescriptions[typ.Name()+"."+name]; exists {
+				property["description"] = description
+			}
+			if def, hasDefault := field.Tag.Lookup("default"); hasDefault {
+				property["default"] = defaultValue(field.Type, def)
+			}
+			if min, hasMin := field.Tag.Lookup("min"); hasMin {
+				if value, err := strconv.Atoi(min); err == nil {
+					property["minimum"] = value
+				}
+			}
+			properties[name] = property
+		}
+
+		schema := map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if required, exists := configRequiredFields[typ.Name()]; exists {
+			schema["required"] = required
+		}
+		return schema
+
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(typ.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	}
+
+	return map[string]any{}
+}
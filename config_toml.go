@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOMLDocument parses TOML config data into a generic tree and records
+// where every key is located
+func parseTOMLDocument(data []byte) (*configDocument, error) {
+	var tree map[string]any
+	if _, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&tree); err != nil {
+		return nil, tomlSyntaxIssue(data, err)
+	}
+
+	return &configDocument{
+		tree:      tomlValue(tree).(map[string]any),
+		positions: tomlPositions(data),
+	}, nil
+}
+
+// tomlSyntaxIssue converts a TOML parse error into a positioned issue
+func tomlSyntaxIssue(data []byte, err error) ConfigIssue {
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		pos := offsetPosition(data, int64(parseErr.Position.Start))
+		if parseErr.Position.Line > 0 {
+			pos.Line = parseErr.Position.Line
+		}
+		return ConfigIssue{Pos: pos, Message: "syntax error: " + parseErr.Message}
+	}
+	return ConfigIssue{Pos: Position{Line: 1, Column: 1}, Message: fmt.Sprintf("syntax error: %v", err)}
+}
+
+// tomlValue converts decoded TOML values to the generic tree used by every config format
+func tomlValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for key, item := range v {
+			obj[key] = tomlValue(item)
+		}
+		return obj
+	case []map[string]any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = tomlValue(item)
+		}
+		return items
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = tomlValue(item)
+		}
+		return items
+	case int64:
+		return json.Number(fmt.Sprint(v))
+	case float64:
+		return floatNumber(v)
+	}
+	return value
+}
+
+// tomlPositions finds the line and column of every table header and key. TOML
+// has no position API, so the file is scanned line by line, counting [[array]]
+// tables to produce paths like profiles[1].applications[0].process_name. Keys
+// inside inline tables resolve to the position of the key that holds them.
+func tomlPositions(data []byte) map[string]Position {
+	positions := make(map[string]Position)
+	arrays := make(map[string]int) // map of array table path to its number of items
+	table := ""
+
+	// resolve turns a dotted header into a path, indexing the latest item of array tables
+	resolve := func(parts []string) string {
+		p := ""
+		for _, part := range parts {
+			p = joinConfigPath(p, part)
+			if count, isArray := arrays[p]; isArray {
+				p = fmt.Sprintf("%s[%d]", p, count-1)
+			}
+		}
+		return p
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+		pos := Position{Line: lineNum, Column: column}
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+
+		case strings.HasPrefix(trimmed, "[["):
+			end := strings.Index(trimmed, "]]")
+			if end == -1 {
+				continue
+			}
+			parts := tomlKeyParts(trimmed[2:end])
+			if len(parts) == 0 {
+				continue
+			}
+			arrayPath := joinConfigPath(resolve(parts[:len(parts)-1]), parts[len(parts)-1])
+			arrays[arrayPath]++
+			table = fmt.Sprintf("%s[%d]", arrayPath, arrays[arrayPath]-1)
+			positions[table] = pos
+			if _, exists := positions[arrayPath]; !exists {
+				positions[arrayPath] = pos
+			}
+
+		case strings.HasPrefix(trimmed, "["):
+			end := strings.Index(trimmed, "]")
+			if end == -1 {
+				continue
+			}
+			table = resolve(tomlKeyParts(trimmed[1:end]))
+			positions[table] = pos
+
+		default:
+			key, _, found := strings.Cut(trimmed, "=")
+			if !found {
+				continue
+			}
+			p := table
+			for _, part := range tomlKeyParts(key) {
+				p = joinConfigPath(p, part)
+			}
+			positions[p] = pos
+		}
+	}
+
+	return positions
+}
+
+// tomlKeyParts splits a dotted TOML key and removes quotes around each part
+func tomlKeyParts(key string) []string {
+	var parts []string
+	for _, part := range strings.Split(key, ".") {
+		part = strings.Trim(strings.TrimSpace(part), `"'`)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// encodeTOMLConfig converts JSON encoded config data to TOML. The TOML encoder
+// can't keep comments, so they are lost when the file is saved.
+func encodeTOMLConfig(data []byte) ([]byte, error) {
+	tree, err := decodeJSONTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(tomlEncodable(tree)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tomlEncodable converts json.Number values in a generic tree to the integer and
+// float types the TOML encoder understands
+func tomlEncodable(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for key, item := range v {
+			obj[key] = tomlEncodable(item)
+		}
+		return obj
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = tomlEncodable(item)
+		}
+		return items
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
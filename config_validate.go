@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Position is a 1-based line and column in a config file
+type Position struct {
+	Line   int
+	Column int
+}
+
+// ConfigIssue describes a single problem found in a config file
+type ConfigIssue struct {
+	Path    string // e.g. applications[0].resolution.width
+	File    string // Layer the value comes from, empty for the main config file
+	Pos     Position
+	Message string
+}
+
+func (i ConfigIssue) String() string {
+	location := ""
+	if i.File != "" {
+		location = i.File + ": "
+	}
+	if i.Pos.Line == 0 {
+		return location + i.Message
+	}
+	return fmt.Sprintf("%sline %d, column %d: %s", location, i.Pos.Line, i.Pos.Column, i.Message)
+}
+
+// Error lets a single issue be returned where an error is expected
+func (i ConfigIssue) Error() string {
+	return i.String()
+}
+
+// ConfigError is returned when a config file is syntactically or semantically invalid
+type ConfigError struct {
+	File   string
+	Issues []ConfigIssue
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Issues) == 1 {
+		return fmt.Sprintf("invalid config %s: %s", e.File, e.Issues[0])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config %s: %d problems", e.File, len(e.Issues))
+	for _, issue := range e.Issues {
+		fmt.Fprintf(&b, "\n  %s", issue)
+	}
+	return b.String()
+}
+
+// configDocument is a parsed config file before it is decoded into a Config
+type configDocument struct {
+	tree      map[string]any
+	positions map[string]Position // map of value path to its position in the file
+	files     map[string]string   // map of value path to the layer file it was merged from
+}
+
+// position returns the position of a path and the layer file it is in, falling
+// back to its closest parent
+func (doc *configDocument) position(p string) (Position, string) {
+	for p != "" {
+		if pos, exists := doc.positions[p]; exists {
+			return pos, doc.files[p]
+		}
+		if idx := strings.LastIndexAny(p, ".["); idx != -1 {
+			p = p[:idx]
+		} else {
+			p = ""
+		}
+	}
+	return Position{Line: 1, Column: 1}, ""
+}
+
+// issue creates a ConfigIssue located at the given path
+func (doc *configDocument) issue(p string, format string, args ...any) ConfigIssue {
+	pos, file := doc.position(p)
+	return ConfigIssue{Path: p, File: file, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// parseJSONDocument parses JSON config data into a generic tree and records
+// where every value is located
+func parseJSONDocument(data []byte) (*configDocument, error) {
+	var tree map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, jsonSyntaxIssue(data, err)
+	}
+	if tree == nil {
+		return nil, ConfigIssue{Pos: Position{Line: 1, Column: 1}, Message: "config must be a JSON object"}
+	}
+
+	doc := &configDocument{tree: tree, positions: make(map[string]Position)}
+	scanner := &jsonPositionScanner{data: data, dec: json.NewDecoder(bytes.NewReader(data)), positions: doc.positions}
+	if err := scanner.scan(""); err != nil {
+		return nil, jsonSyntaxIssue(data, err)
+	}
+
+	return doc, nil
+}
+
+// jsonSyntaxIssue converts a JSON decoding error into a positioned issue
+func jsonSyntaxIssue(data []byte, err error) ConfigIssue {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return ConfigIssue{Pos: offsetPosition(data, syntaxErr.Offset), Message: syntaxErr.Error()}
+	case errors.As(err, &typeErr):
+		return ConfigIssue{Pos: offsetPosition(data, typeErr.Offset), Message: "config must be a JSON object"}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ConfigIssue{Pos: offsetPosition(data, int64(len(data))), Message: "unexpected end of file"}
+	}
+	return ConfigIssue{Message: err.Error()}
+}
+
+// offsetPosition converts a byte offset into a line and column
+func offsetPosition(data []byte, offset int64) Position {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	prefix := data[:offset]
+	line := bytes.Count(prefix, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(prefix, '\n')
+	return Position{Line: line, Column: column}
+}
+
+// jsonPositionScanner walks the JSON tokens to find the position of every value
+type jsonPositionScanner struct {
+	data      []byte
+	dec       *json.Decoder
+	positions map[string]Position
+}
+
+// nextTokenStart returns the offset of the next token, skipping separators
+func (s *jsonPositionScanner) nextTokenStart() int64 {
+	offset := s.dec.InputOffset()
+	for offset < int64(len(s.data)) {
+		switch s.data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// scan records the position of the value at p and everything nested in it
+func (s *jsonPositionScanner) scan(p string) error {
+	start := s.nextTokenStart()
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if _, recorded := s.positions[p]; !recorded {
+		s.positions[p] = offsetPosition(s.data, start)
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for s.dec.More() {
+			keyStart := s.nextTokenStart()
+			keyTok, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			// Object members are reported at their key
+			childPath := joinConfigPath(p, keyTok.(string))
+			s.positions[childPath] = offsetPosition(s.data, keyStart)
+			if err := s.scan(childPath); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	case json.Delim('['):
+		for i := 0; s.dec.More(); i++ {
+			if err := s.scan(fmt.Sprintf("%s[%d]", p, i)); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	}
+	return err
+}
+
+// joinConfigPath appends an object key to a value path
+func joinConfigPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// jsonFieldNames returns the JSON keys of a struct type mapped to their field types
+func jsonFieldNames(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// checkTree verifies that a generic value matches the shape of typ: no unknown
+// keys and values of the right kind and range
+func (doc *configDocument) checkTree(value any, typ reflect.Type, p string) []ConfigIssue {
+	if typ.Kind() == reflect.Pointer {
+		if value == nil {
+			return nil
+		}
+		typ = typ.Elem()
+	}
+
+	var issues []ConfigIssue
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []ConfigIssue{doc.issue(p, "%s must be an object", describePath(p))}
+		}
+		fields := jsonFieldNames(typ)
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := joinConfigPath(p, key)
+			fieldType, known := fields[key]
+			if !known {
+				issues = append(issues, doc.issue(childPath, "unknown field %q%s", key, suggestField(key, fields)))
+				continue
+			}
+			issues = append(issues, doc.checkTree(obj[key], fieldType, childPath)...)
+		}
+
+	case reflect.Slice:
+		if value == nil {
+			return nil
+		}
+		items, ok := value.([]any)
+		if !ok {
+			return []ConfigIssue{doc.issue(p, "%s must be a list", describePath(p))}
+		}
+		for i, item := range items {
+			issues = append(issues, doc.checkTree(item, typ.Elem(), fmt.Sprintf("%s[%d]", p, i))...)
+		}
+
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			issues = append(issues, doc.issue(p, "%s must be a string", describePath(p)))
+		}
+
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			issues = append(issues, doc.issue(p, "%s must be true or false", describePath(p)))
+		}
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		number, ok := value.(json.Number)
+		if _, err := strconv.ParseInt(number.String(), 10, typ.Bits()); !ok || err != nil {
+			issues = append(issues, doc.issue(p, "%s must be a whole number", describePath(p)))
+		}
+
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		number, ok := value.(json.Number)
+		if _, err := strconv.ParseUint(number.String(), 10, typ.Bits()); !ok || err != nil {
+			issues = append(issues, doc.issue(p, "%s must be a non-negative whole number", describePath(p)))
+		}
+	}
+
+	return issues
+}
+
+// sortIssues orders issues by file (main config file first) and position
+func sortIssues(issues []ConfigIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		if issues[i].Pos.Line != issues[j].Pos.Line {
+			return issues[i].Pos.Line < issues[j].Pos.Line
+		}
+		return issues[i].Pos.Column < issues[j].Pos.Column
+	})
+}
+
+// describePath names a value in messages, e.g. "applications[0].resolution.width"
+func describePath(p string) string {
+	if p == "" {
+		return "config"
+	}
+	return fmt.Sprintf("%q", p)
+}
+
+// suggestField returns a hint for a misspelt key, e.g. `, did you mean "width"?`
+func suggestField(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3 // Only suggest names that are close
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance || (d == bestDistance && best != "" && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// validateConfig checks the decoded configuration for values that are well-formed
+// but can't work: zero dimensions, duplicate process rules, bad monitor names and
+// references to profiles that don't exist
+func (doc *configDocument) validateConfig(config *Config) []ConfigIssue {
+	var issues []ConfigIssue
+
+	if config.PollInterval < 1 {
+		issues = append(issues, doc.issue("poll_interval", "poll_interval must be at least 1 second"))
+	}
+
+	issues = append(issues, doc.validateRules(config.Applications, "applications")...)
+
+	profiles := make(map[string]int)
+	for i, profile := range config.Profiles {
+		profilePath := fmt.Sprintf("profiles[%d]", i)
+
+		if strings.TrimSpace(profile.Name) == "" {
+			issues = append(issues, doc.issue(profilePath+".name", "profile name is required"))
+		} else if first, duplicate := profiles[strings.ToLower(profile.Name)]; duplicate {
+			issues = append(issues, doc.issue(profilePath+".name", "duplicate profile %q, already defined by profiles[%d]", profile.Name, first))
+		} else {
+			profiles[strings.ToLower(profile.Name)] = i
+		}
+
+		// A disabled profile only removes a profile inherited from another layer
+		if profile.Disabled {
+			continue
+		}
+
+		if profile.PollInterval != nil && *profile.PollInterval < 1 {
+			issues = append(issues, doc.issue(profilePath+".poll_interval", "%s.poll_interval must be at least 1 second", profilePath))
+		}
+
+		issues = append(issues, doc.validateRules(profile.Applications, profilePath+".applications")...)
+	}
+
+	if config.ActiveProfile != "" && config.Profile(config.ActiveProfile) == nil {
+		issues = append(issues, doc.issue("active_profile", "active_profile %q does not match any profile", config.ActiveProfile))
+	}
+
+	if config.HTTP != nil {
+		issues = append(issues, doc.validateHTTP(config.HTTP)...)
+	}
+
+	return issues
+}
+
+// validateHTTP checks the dashboard settings. Addresses other computers can reach
+// need a token, anyone on the network could change resolutions otherwise.
+func (doc *configDocument) validateHTTP(http *HTTPConfig) []ConfigIssue {
+	host, _, err := net.SplitHostPort(http.Address)
+	if err != nil {
+		return []ConfigIssue{doc.issue("http.address", "invalid http.address %q, expected host:port like 127.0.0.1:8765", http.Address)}
+	}
+	if http.Token == "" && !isLoopbackHost(host) {
+		return []ConfigIssue{doc.issue("http.address", "http.token is required when http.address %q can be reached from other computers", http.Address)}
+	}
+	return nil
+}
+
+// validateRules checks a list of application rules located at path p
+func (doc *configDocument) validateRules(apps []AppConfig, p string) []ConfigIssue {
+	var issues []ConfigIssue
+
+	seen := make(map[string]int)
+	for i, app := range apps {
+		appPath := fmt.Sprintf("%s[%d]", p, i)
+
+		if strings.TrimSpace(app.ProcessName) == "" {
+			issues = append(issues, doc.issue(appPath+".process_name", "process_name is required"))
+		} else if first, duplicate := seen[strings.ToLower(app.ProcessName)]; duplicate {
+			issues = append(issues, doc.issue(appPath+".process_name", "duplicate rule for %q, already defined by %s[%d]", app.ProcessName, p, first))
+		} else {
+			seen[strings.ToLower(app.ProcessName)] = i
+		}
+
+		// A disabled rule only switches off a rule inherited from another layer
+		if app.Disabled {
+			continue
+		}
+
+		issues = append(issues, doc.validateResolution(app.Resolution, appPath+".resolution")...)
+		if app.RestoreResolution != nil {
+			issues = append(issues, doc.validateResolution(*app.RestoreResolution, appPath+".restore_resolution")...)
+		}
+
+		if err := validateMonitorName(app.MonitorName); err != nil {
+			issues = append(issues, doc.issue(appPath+".monitor_name", "%v", err))
+		}
+	}
+
+	return issues
+}
+
+// validateResolution rejects resolutions with a zero width or height
+func (doc *configDocument) validateResolution(res Resolution, p string) []ConfigIssue {
+	var issues []ConfigIssue
+	if res.Width == 0 {
+		issues = append(issues, doc.issue(p+".width", "%s.width must be greater than 0", p))
+	}
+	if res.Height == 0 {
+		issues = append(issues, doc.issue(p+".height", "%s.height must be greater than 0", p))
+	}
+	return issues
+}
+
+// validateMonitorName checks that a monitor name has a recognised form
+func validateMonitorName(monitorName string) error {
+	switch {
+	case monitorName == "":
+		return nil // Primary monitor
+	case strings.HasPrefix(monitorName, MonitorNamePrefix):
+		if _, err := path.Match(strings.TrimPrefix(monitorName, MonitorNamePrefix), ""); err != nil {
+			return fmt.Errorf("invalid monitor name pattern %q: %w", monitorName, err)
+		}
+	case strings.HasPrefix(monitorName, MonitorIDPrefix), strings.HasPrefix(monitorName, MonitorEDIDPrefix):
+		if _, value, _ := strings.Cut(monitorName, ":"); value == "" {
+			return fmt.Errorf("monitor identifier %q is empty", monitorName)
+		}
+	case !isDeviceName(monitorName):
+		return fmt.Errorf("unknown monitor %q, expected a device name like %s or an id:, edid: or name: identifier", monitorName, deviceNameExample)
+	}
+	return nil
+}
+
+// ValidateConfigMonitors reports rules whose monitor is not connected or is ambiguous
+func ValidateConfigMonitors(config *Config, monitors []MonitorInfo) error {
+	doc := config.document
+	if doc == nil {
+		doc = &configDocument{}
+	}
+
+	var issues []ConfigIssue
+	for i, app := range config.Rules() {
+		if app.MonitorName == "" || app.Disabled {
+			continue
+		}
+		if _, err := resolveMonitorName(app.MonitorName, monitors); err != nil {
+			issues = append(issues, doc.issue(fmt.Sprintf("%s[%d].monitor_name", config.rulesPath(), i), "%v", err))
+		}
+	}
+
+	if len(issues) > 0 {
+		return &ConfigError{File: config.source, Issues: issues}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlErrorLine extracts the line number from yaml.v3 error messages
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// parseYAMLDocument parses YAML config data into a generic tree and records
+// where every value is located
+func parseYAMLDocument(data []byte) (*configDocument, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlSyntaxIssue(err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, ConfigIssue{Pos: Position{Line: 1, Column: 1}, Message: "config must be a YAML mapping"}
+	}
+
+	doc := &configDocument{positions: make(map[string]Position)}
+	tree, err := doc.yamlValue(root.Content[0], "")
+	if err != nil {
+		return nil, err
+	}
+	doc.tree = tree.(map[string]any)
+
+	return doc, nil
+}
+
+// yamlSyntaxIssue converts a YAML parse error into a positioned issue
+func yamlSyntaxIssue(err error) ConfigIssue {
+	if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return ConfigIssue{Pos: Position{Line: line, Column: 1}, Message: "syntax error: " + match[2]}
+	}
+	return ConfigIssue{Pos: Position{Line: 1, Column: 1}, Message: fmt.Sprintf("syntax error: %v", err)}
+}
+
+// yamlValue converts a YAML node to the generic tree used by every config format
+func (doc *configDocument) yamlValue(node *yaml.Node, p string) (any, error) {
+	doc.positions[p] = Position{Line: node.Line, Column: node.Column}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return doc.yamlValue(node.Alias, p)
+
+	case yaml.MappingNode:
+		obj := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			if keyNode.Kind != yaml.ScalarNode {
+				return nil, ConfigIssue{Pos: Position{Line: keyNode.Line, Column: keyNode.Column}, Message: "keys must be strings"}
+			}
+			value, err := doc.yamlValue(valueNode, joinConfigPath(p, keyNode.Value))
+			if err != nil {
+				return nil, err
+			}
+			// Report the key rather than the value, like the JSON scanner does
+			doc.positions[joinConfigPath(p, keyNode.Value)] = Position{Line: keyNode.Line, Column: keyNode.Column}
+			obj[keyNode.Value] = value
+		}
+		return obj, nil
+
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(node.Content))
+		for i, itemNode := range node.Content {
+			item, err := doc.yamlValue(itemNode, fmt.Sprintf("%s[%d]", p, i))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return nil, ConfigIssue{Pos: Position{Line: node.Line, Column: node.Column}, Message: err.Error()}
+			}
+			return b, nil
+		case "!!int":
+			var n int64
+			if err := node.Decode(&n); err != nil {
+				return nil, ConfigIssue{Pos: Position{Line: node.Line, Column: node.Column}, Message: err.Error()}
+			}
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		case "!!float":
+			var f float64
+			if err := node.Decode(&f); err != nil {
+				return nil, ConfigIssue{Pos: Position{Line: node.Line, Column: node.Column}, Message: err.Error()}
+			}
+			return floatNumber(f), nil
+		}
+		return node.Value, nil
+	}
+
+	return nil, ConfigIssue{Pos: Position{Line: node.Line, Column: node.Column}, Message: "unsupported YAML value"}
+}
+
+// encodeYAMLConfig converts JSON encoded config data to YAML. When the file
+// already exists its document is updated in place, so comments and key order are
+// kept for every key that is still present.
+func encodeYAMLConfig(data []byte, filename string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := yamlNodeFromJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{node}}
+	if existing, err := os.ReadFile(filename); err == nil {
+		var current yaml.Node
+		if yaml.Unmarshal(existing, &current) == nil && len(current.Content) == 1 && current.Content[0].Kind == yaml.MappingNode {
+			mergeYAMLNode(current.Content[0], node)
+			root = &current
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNodeFromJSON builds a YAML node from a JSON token stream, keeping the
+// field order of the encoded struct
+func yamlNodeFromJSON(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := tok.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if value == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			item, err := yamlNodeFromJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, item)
+		}
+		// Closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: value.String()}, nil
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: value.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+
+	return nil, errors.New("unexpected JSON token")
+}
+
+// mergeYAMLNode updates dst in place to hold the values of src while keeping the
+// comments of dst. Mapping keys keep their order, new keys are appended, and list
+// items are matched by their process_name or name so comments follow the rule.
+func mergeYAMLNode(dst, src *yaml.Node) {
+	if dst.Kind != src.Kind {
+		head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+		*dst = *src
+		dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+		return
+	}
+
+	switch dst.Kind {
+	case yaml.ScalarNode:
+		if dst.ShortTag() != src.Tag {
+			dst.Style = src.Style
+		}
+		dst.Tag, dst.Value = src.Tag, src.Value
+
+	case yaml.MappingNode:
+		values := make(map[string]*yaml.Node, len(src.Content)/2)
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			values[src.Content[i].Value] = src.Content[i+1]
+		}
+
+		content := make([]*yaml.Node, 0, len(src.Content))
+		kept := make(map[string]bool)
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			key := dst.Content[i].Value
+			if value, exists := values[key]; exists && !kept[key] {
+				mergeYAMLNode(dst.Content[i+1], value)
+				content = append(content, dst.Content[i], dst.Content[i+1])
+				kept[key] = true
+			}
+		}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			if !kept[src.Content[i].Value] {
+				content = append(content, src.Content[i], src.Content[i+1])
+			}
+		}
+		dst.Content = content
+
+	case yaml.SequenceNode:
+		existing := make(map[string]*yaml.Node)
+		for _, item := range dst.Content {
+			if key := yamlItemKey(item); key != "" {
+				existing[key] = item
+			}
+		}
+
+		content := make([]*yaml.Node, 0, len(src.Content))
+		for i, item := range src.Content {
+			var match *yaml.Node
+			if key := yamlItemKey(item); key != "" {
+				match = existing[key]
+				delete(existing, key)
+			} else if i < len(dst.Content) && yamlItemKey(dst.Content[i]) == "" {
+				match = dst.Content[i]
+			}
+
+			if match == nil {
+				content = append(content, item)
+				continue
+			}
+			mergeYAMLNode(match, item)
+			content = append(content, match)
+		}
+		dst.Content = content
+	}
+}
+
+// yamlItemKey identifies a list item by its process_name or name value
+func yamlItemKey(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case "process_name", "name":
+			return node.Content[i].Value + "=" + node.Content[i+1].Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"csres/version"
+)
+
+// The control API lets other processes query and steer a running GUI or csres run.
+// It speaks JSON-RPC 2.0 over a named pipe on Windows and a Unix domain socket
+// elsewhere, one request or response per line.
+
+// JSON-RPC error codes
+const (
+	controlParseError     = -32700
+	controlInvalidRequest = -32600
+	controlMethodNotFound = -32601
+	controlInvalidParams  = -32602
+	controlServerError    = -32000 // The method failed, e.g. an unknown profile
+)
+
+// controlMaxMessageSize limits the size of a single request line
+const controlMaxMessageSize = 1 << 20
+
+var (
+	// errControlNotRunning is returned by dialControl when nothing listens on the endpoint
+	errControlNotRunning = errors.New("csres is not running with this config")
+
+	// errAlreadyRunning is returned by listenControl when another instance owns the endpoint
+	errAlreadyRunning = errors.New("csres is already running with this config")
+)
+
+// ControlHandler carries out the requests of the control API, for the engine of
+// csres run or for the GUI
+type ControlHandler interface {
+	Status() EngineStatus
+	Show() error // Brings the main window to the front
+	Pause() error
+	Resume() error
+	ApplyRule(processName string) error
+	RestoreAll() error
+	SwitchProfile(name string) error // Empty name switches back to the top-level applications
+	ReloadConfig() error
+	Rules() []RuleStatus     // Enabled rules of the active profile
+	History() []HistoryEntry // Most recent resolution changes, oldest first
+	Events() *EventHub
+}
+
+// controlListener accepts connections on the control endpoint
+type controlListener interface {
+	Accept() (io.ReadWriteCloser, error)
+	Close() error
+}
+
+// controlRequest is a JSON-RPC request. Requests without an ID are notifications
+// and get no response.
+type controlRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// controlResponse is a JSON-RPC response, with either a result or an error
+type controlResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *controlError   `json:"error,omitempty"`
+}
+
+// controlNotification is a JSON-RPC notification from the server, used for events
+type controlNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// controlError is a JSON-RPC error object
+type controlError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *controlError) Error() string {
+	return e.Message
+}
+
+// applyRuleParams are the parameters of apply_rule
+type applyRuleParams struct {
+	ProcessName string `json:"process_name"`
+}
+
+// switchProfileParams are the parameters of switch_profile
+type switchProfileParams struct {
+	Profile string `json:"profile"` // Empty = the top-level applications
+}
+
+// engineControl steers the engine of csres run
+type engineControl struct {
+	monitor *ResolutionMonitor
+}
+
+func (c engineControl) Status() EngineStatus {
+	return c.monitor.Status()
+}
+
+func (c engineControl) Show() error {
+	return fmt.Errorf("csres run has no window")
+}
+
+func (c engineControl) Pause() error {
+	c.monitor.Pause()
+	return nil
+}
+
+func (c engineControl) Resume() error {
+	return c.monitor.Resume()
+}
+
+func (c engineControl) ApplyRule(processName string) error {
+	return c.monitor.ApplyRule(processName)
+}
+
+func (c engineControl) RestoreAll() error {
+	c.monitor.RestoreAll()
+	return nil
+}
+
+func (c engineControl) SwitchProfile(name string) error {
+	return c.monitor.SwitchProfile(name)
+}
+
+func (c engineControl) ReloadConfig() error {
+	return c.monitor.ReloadConfig()
+}
+
+func (c engineControl) Rules() []RuleStatus {
+	return c.monitor.Rules()
+}
+
+func (c engineControl) History() []HistoryEntry {
+	return c.monitor.History()
+}
+
+func (c engineControl) Events() *EventHub {
+	return c.monitor.events
+}
+
+// ControlServer answers control API requests on the control endpoint
+type ControlServer struct {
+	handler  ControlHandler
+	mode     string // Command that runs the server, gui or run
+	listener controlListener
+}
+
+// ListenControl claims the control endpoint of a config file. Only one process
+// can own it, which keeps a second instance for the same config and user from
+// starting; it fails with errAlreadyRunning then. Requests wait until Serve is called.
+func ListenControl(configFile string) (*ControlServer, error) {
+	endpoint := controlEndpoint(configFile)
+	listener, err := listenControl(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Control API listening on %s", endpoint)
+	return &ControlServer{listener: listener}, nil
+}
+
+// Serve starts answering requests in the background
+func (s *ControlServer) Serve(handler ControlHandler, mode string) {
+	s.handler = handler
+	s.mode = mode
+	go s.serve()
+}
+
+// Close stops accepting connections
+func (s *ControlServer) Close() error {
+	return s.listener.Close()
+}
+
+// serve accepts connections until the server is closed
+func (s *ControlServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logErrorf("Error accepting control connection: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the requests of a single client until it disconnects
+func (s *ControlServer) serveConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), controlMaxMessageSize)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		response, method := s.handle(line)
+		if method == "subscribe" && (response == nil || response.Error == nil) {
+			s.streamEvents(scanner, enc, response)
+			return
+		}
+		if response == nil {
+			continue
+		}
+		if err := enc.Encode(response); err != nil {
+			debugf("Control client disconnected: %v", err)
+			return
+		}
+	}
+}
+
+// streamEvents sends every event to a client that subscribed, as "event"
+// notifications, until it disconnects. The response to subscribe goes first.
+func (s *ControlServer) streamEvents(scanner *bufio.Scanner, enc *json.Encoder, response *controlResponse) {
+	events, cancel := s.handler.Events().Subscribe()
+	defer cancel()
+
+	if response != nil {
+		if err := enc.Encode(response); err != nil {
+			debugf("Control client disconnected: %v", err)
+			return
+		}
+	}
+
+	// Further requests are ignored, reading only notices when the client disconnects
+	disconnected := make(chan struct{})
+	go func() {
+		for scanner.Scan() {
+		}
+		close(disconnected)
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if err := enc.Encode(controlNotification{JSONRPC: "2.0", Method: "event", Params: event}); err != nil {
+				debugf("Control client disconnected: %v", err)
+				return
+			}
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+// handle answers a single request, or returns nil for notifications. The method
+// is returned as well, empty if the request could not be read.
+func (s *ControlServer) handle(line []byte) (*controlResponse, string) {
+	response := &controlResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+
+	var request controlRequest
+	if err := json.Unmarshal(line, &request); err != nil {
+		response.Error = &controlError{Code: controlParseError, Message: fmt.Sprintf("invalid request: %v", err)}
+		return response, ""
+	}
+	if request.ID != nil {
+		response.ID = request.ID
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		response.Error = &controlError{Code: controlInvalidRequest, Message: `request needs "jsonrpc": "2.0" and a method`}
+		return response, ""
+	}
+
+	debugf("Control request: %s", request.Method)
+	result, err := s.call(request.Method, request.Params)
+	if request.ID == nil {
+		if err != nil {
+			logErrorf("Error handling control notification %s: %v", request.Method, err)
+		}
+		return nil, request.Method
+	}
+
+	if err == nil {
+		response.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		var rpcErr *controlError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &controlError{Code: controlServerError, Message: err.Error()}
+		}
+		response.Error = rpcErr
+		response.Result = nil
+	}
+	return response, request.Method
+}
+
+// call runs a method. Every method returns the status after it ran.
+func (s *ControlServer) call(method string, params json.RawMessage) (*ControlStatus, error) {
+	var err error
+	switch method {
+	case "status":
+	case "subscribe": // The connection carries events from now on, see streamEvents
+	case "show":
+		err = s.handler.Show()
+	case "pause":
+		err = s.handler.Pause()
+	case "resume":
+		err = s.handler.Resume()
+	case "apply_rule":
+		var p applyRuleParams
+		if err := decodeControlParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.ProcessName == "" {
+			return nil, &controlError{Code: controlInvalidParams, Message: "process_name is required"}
+		}
+		err = s.handler.ApplyRule(p.ProcessName)
+	case "restore_all":
+		err = s.handler.RestoreAll()
+	case "switch_profile":
+		var p switchProfileParams
+		if err := decodeControlParams(params, &p); err != nil {
+			return nil, err
+		}
+		err = s.handler.SwitchProfile(p.Profile)
+	case "reload_config":
+		err = s.handler.ReloadConfig()
+	default:
+		return nil, &controlError{Code: controlMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newControlStatus(s.handler, s.mode), nil
+}
+
+// newControlStatus returns the status of a handler as reported by the control API
+func newControlStatus(handler ControlHandler, mode string) *ControlStatus {
+	return &ControlStatus{
+		EngineStatus: handler.Status(),
+		Mode:         mode,
+		PID:          os.Getpid(),
+		Version:      version.Get(),
+	}
+}
+
+// decodeControlParams decodes the parameters of a request, which may be missing
+func decodeControlParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &controlError{Code: controlInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
+
+// controlConfigKey identifies a config file in the name of its control endpoint
+func controlConfigKey(configFile string) string {
+	// Paths are case-insensitive on Windows
+	sum := sha256.Sum256([]byte(strings.ToLower(filepath.Clean(configFile))))
+	return hex.EncodeToString(sum[:6])
+}
+
+// callControl sends a request to the instance running with a config file and
+// returns the status it reports after handling it
+func callControl(configFile, method string, params any) (*ControlStatus, error) {
+	conn, err := dialControl(controlEndpoint(configFile))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request := controlRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method}
+	if params != nil {
+		if request.Params, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, fmt.Errorf("failed to send control request: %w", err)
+	}
+
+	var response controlResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to read control response: %w", err)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	var status ControlStatus
+	if err := json.Unmarshal(response.Result, &status); err != nil {
+		return nil, fmt.Errorf("failed to decode control response: %w", err)
+	}
+	return &status, nil
+}
+
+// subscribeControl subscribes to the events of the instance running with a config
+// file and calls fn for each, until the instance exits or fn fails
+func subscribeControl(configFile string, fn func(Event) error) error {
+	conn, err := dialControl(controlEndpoint(configFile))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	request := controlRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: "subscribe"}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return fmt.Errorf("failed to send control request: %w", err)
+	}
+
+	dec := json.NewDecoder(conn)
+	var response controlResponse
+	if err := dec.Decode(&response); err != nil {
+		return fmt.Errorf("failed to read control response: %w", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+
+	for {
+		var notification controlRequest
+		if err := dec.Decode(&notification); errors.Is(err, io.EOF) {
+			return fmt.Errorf("csres exited")
+		} else if err != nil {
+			return fmt.Errorf("failed to read event: %w", err)
+		}
+		if notification.Method != "event" {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(notification.Params, &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// ctlCommand sends a request to the running GUI or csres run through the control API
+func ctlCommand() *command {
+	return &command{
+		name:    "ctl",
+		args:    "<action> [argument]",
+		summary: "Control the running instance: status, show, pause, resume, apply <process>, restore, profile [name], reload or events",
+		run: func(opts *commandOptions, args []string) error {
+			if len(args) == 0 {
+				return usageError{"missing action"}
+			}
+
+			var method, done string
+			var params any
+			maxArgs := 1
+			switch args[0] {
+			case "status":
+				method = "status"
+			case "show":
+				method, done = "show", "Window shown"
+			case "pause":
+				method, done = "pause", "Monitoring paused, original resolutions restored"
+			case "resume":
+				method, done = "resume", "Monitoring resumed"
+			case "apply":
+				if len(args) < 2 {
+					return usageError{"missing process name"}
+				}
+				maxArgs = 2
+				method, done = "apply_rule", fmt.Sprintf("Applied the rule for %s", args[1])
+				params = applyRuleParams{ProcessName: args[1]}
+			case "restore":
+				method, done = "restore_all", "Original resolutions restored"
+			case "profile":
+				maxArgs = 2
+				name := ""
+				if len(args) > 1 {
+					name = args[1]
+				}
+				method, done = "switch_profile", fmt.Sprintf("Switched to %s", describeProfile(name))
+				params = switchProfileParams{Profile: name}
+			case "reload":
+				method, done = "reload_config", "Configuration reloaded"
+			case "events":
+				method = "subscribe"
+			default:
+				return usageError{fmt.Sprintf("unknown action %q", args[0])}
+			}
+			if err := expectArgs(args, 1, maxArgs); err != nil {
+				return err
+			}
+
+			configFile, err := opts.resolveConfig(nil)
+			if err != nil {
+				return err
+			}
+			// Events are printed as they happen, until csres exits or the command is interrupted
+			if method == "subscribe" {
+				enc := json.NewEncoder(os.Stdout)
+				return subscribeControl(configFile, func(event Event) error {
+					if opts.jsonOutput {
+						return enc.Encode(event)
+					}
+					printEvent(event)
+					return nil
+				})
+			}
+
+			status, err := callControl(configFile, method, params)
+			if err != nil {
+				return err
+			}
+
+			if opts.jsonOutput {
+				return printJSON(status)
+			}
+			if done != "" {
+				fmt.Println(done)
+				return nil
+			}
+			printControlStatus(status)
+			return nil
+		},
+	}
+}
+
+// printControlStatus prints the status of the running instance
+func printControlStatus(status *ControlStatus) {
+	state := "running"
+	if status.Paused {
+		state = "paused"
+	}
+	if status.DryRun {
+		state += ", dry run"
+	}
+
+	fmt.Printf("csres %s %s (PID %d)\n", status.Mode, status.Version.Short(), status.PID)
+	fmt.Printf("Config:   %s\n", status.ConfigFile)
+	fmt.Printf("Profile:  %s\n", describeProfile(status.ActiveProfile))
+	fmt.Printf("State:    %s\n", state)
+	fmt.Println("Monitors:")
+	for _, monitor := range status.Monitors {
+		mode := "unknown mode"
+		if monitor.Current != nil {
+			mode = FormatResolution(*monitor.Current)
+		}
+		fmt.Printf("  %s: %s - %s", monitor.DeviceName, monitor.Name, mode)
+		if len(monitor.OwnedBy) > 0 && monitor.Baseline != nil {
+			fmt.Printf(" (changed by %s, restores to %s)", strings.Join(monitor.OwnedBy, ", "), FormatResolution(*monitor.Baseline))
+		}
+		fmt.Println()
+	}
+	fmt.Println("Active applications:")
+	if len(status.ActiveApps) == 0 {
+		fmt.Println("  none")
+	}
+	for _, app := range status.ActiveApps {
+		target := "waiting for its monitor"
+		if app.Applied {
+			target = "on " + app.DeviceName
+		}
+		fmt.Printf("  %s: %s %s\n", app.ProcessName, FormatResolution(app.Resolution), target)
+	}
+}
+
+// printEvent prints an event of the running instance on a single line
+func printEvent(event Event) {
+	var details []string
+	if event.ProcessName != "" {
+		details = append(details, event.ProcessName)
+	}
+	if len(event.ProcessIDs) > 0 {
+		pids := make([]string, len(event.ProcessIDs))
+		for i, pid := range event.ProcessIDs {
+			pids[i] = fmt.Sprint(pid)
+		}
+		details = append(details, "PID "+strings.Join(pids, ", "))
+	}
+	if event.Monitor != nil {
+		details = append(details, fmt.Sprintf("%s (%s)", event.Monitor.DeviceName, event.Monitor.Name))
+	}
+	if event.Resolution != nil {
+		target := FormatResolution(*event.Resolution)
+		if event.DeviceName != "" {
+			target += " on " + event.DeviceName
+		}
+		details = append(details, target)
+	}
+	if event.DryRun {
+		details = append(details, "dry run")
+	}
+	if event.Error != "" {
+		details = append(details, event.Error)
+	}
+
+	fmt.Printf("%s %-19s %s\n", event.Time.Format("15:04:05"), event.Type, strings.Join(details, ", "))
+}
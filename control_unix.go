@@ -0,0 +1,69 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// controlEndpoint returns the path of the control socket for a config file, one per user
+func controlEndpoint(configFile string) string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, fmt.Sprintf("csres-%s.sock", controlConfigKey(configFile)))
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("csres-%d-%s.sock", os.Getuid(), controlConfigKey(configFile)))
+}
+
+// socketListener accepts connections on a Unix domain socket
+type socketListener struct {
+	listener net.Listener
+}
+
+func (l socketListener) Accept() (io.ReadWriteCloser, error) {
+	return l.listener.Accept()
+}
+
+func (l socketListener) Close() error {
+	return l.listener.Close()
+}
+
+// listenControl creates the control socket. A socket left behind by an instance
+// that crashed is replaced, one that still answers is in use.
+func listenControl(path string) (controlListener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errAlreadyRunning
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// Only the user running csres may control it
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	return socketListener{listener: listener}, nil
+}
+
+// dialControl connects to the control socket of the running instance
+func dialControl(path string) (io.ReadWriteCloser, error) {
+	conn, err := net.Dial("unix", path)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, errControlNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	PIPE_ACCESS_DUPLEX            = 0x00000003
+	FILE_FLAG_FIRST_PIPE_INSTANCE = 0x00080000
+	PIPE_TYPE_BYTE                = 0x00000000
+	PIPE_READMODE_BYTE            = 0x00000000
+	PIPE_WAIT                     = 0x00000000
+	PIPE_REJECT_REMOTE_CLIENTS    = 0x00000008
+	PIPE_UNLIMITED_INSTANCES      = 255
+	ERROR_PIPE_BUSY               = 231
+	ERROR_PIPE_CONNECTED          = 535
+)
+
+const (
+	// controlPipeBufferSize is the size of the input and output buffers of each pipe instance
+	controlPipeBufferSize = 4096
+
+	// controlDialAttempts is how often a client retries while every pipe instance is busy
+	controlDialAttempts = 20
+)
+
+// controlEndpoint returns the name of the control pipe for a config file, one per user
+func controlEndpoint(configFile string) string {
+	user := os.Getenv("USERNAME")
+	if user == "" {
+		user = "default"
+	}
+	return `\\.\pipe\csres-` + user + "-" + controlConfigKey(configFile)
+}
+
+// pipeListener accepts connections on a named pipe. An unconnected instance of the
+// pipe exists at all times, so no other process can create a pipe with its name.
+type pipeListener struct {
+	name                 string
+	procCreateNamedPipeW *syscall.LazyProc
+	procConnectNamedPipe *syscall.LazyProc
+	mu                   sync.Mutex
+	pending              syscall.Handle // Instance waiting for the next client
+	closed               bool
+}
+
+// listenControl creates the control pipe. It fails if another process owns it.
+func listenControl(name string) (controlListener, error) {
+	kernel32dll := syscall.NewLazyDLL("kernel32.dll")
+	l := &pipeListener{
+		name:                 name,
+		procCreateNamedPipeW: kernel32dll.NewProc("CreateNamedPipeW"),
+		procConnectNamedPipe: kernel32dll.NewProc("ConnectNamedPipe"),
+	}
+
+	handle, err := l.createInstance(true)
+	if errors.Is(err, syscall.ERROR_ACCESS_DENIED) {
+		return nil, errAlreadyRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.pending = handle
+	return l, nil
+}
+
+// createInstance creates an instance of the pipe. Only local clients are accepted,
+// and the default security only lets the owner and administrators write to it.
+func (l *pipeListener) createInstance(first bool) (syscall.Handle, error) {
+	namePtr, err := syscall.UTF16PtrFromString(l.name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert pipe name to UTF16: %w", err)
+	}
+
+	openMode := uint32(PIPE_ACCESS_DUPLEX)
+	if first {
+		openMode |= FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+
+	handle, _, err := l.procCreateNamedPipeW.Call(
+		uintptr(unsafe.Pointer(namePtr)),
+		uintptr(openMode),
+		uintptr(PIPE_TYPE_BYTE|PIPE_READMODE_BYTE|PIPE_WAIT|PIPE_REJECT_REMOTE_CLIENTS),
+		uintptr(PIPE_UNLIMITED_INSTANCES),
+		uintptr(controlPipeBufferSize),
+		uintptr(controlPipeBufferSize),
+		0,
+		0,
+	)
+	if syscall.Handle(handle) == syscall.InvalidHandle {
+		return 0, fmt.Errorf("failed to create named pipe %s: %w", l.name, err)
+	}
+	return syscall.Handle(handle), nil
+}
+
+// Accept waits for a client to connect to the pending instance and creates the
+// next one
+func (l *pipeListener) Accept() (io.ReadWriteCloser, error) {
+	l.mu.Lock()
+	if l.closed {
+		if l.pending != 0 {
+			syscall.CloseHandle(l.pending)
+		}
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if l.pending == 0 {
+		handle, err := l.createInstance(false)
+		if err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+		l.pending = handle
+	}
+	handle := l.pending
+	l.mu.Unlock()
+
+	ret, _, err := l.procConnectNamedPipe.Call(uintptr(handle), 0)
+	// A client that connected between CreateNamedPipeW and ConnectNamedPipe is reported as an error
+	connected := ret != 0 || err == syscall.Errno(ERROR_PIPE_CONNECTED)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending = 0
+	if l.closed {
+		syscall.CloseHandle(handle)
+		return nil, net.ErrClosed
+	}
+	if !connected {
+		syscall.CloseHandle(handle)
+		return nil, fmt.Errorf("failed to accept control connection: %w", err)
+	}
+
+	// The next instance is created right away so the name is never free, if that
+	// fails the next Accept tries again
+	if next, err := l.createInstance(false); err == nil {
+		l.pending = next
+	}
+	return os.NewFile(uintptr(handle), l.name), nil
+}
+
+// Close stops accepting connections. A blocked Accept is woken up by connecting
+// to the pending instance.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	if file, err := os.OpenFile(l.name, os.O_RDWR, 0); err == nil {
+		file.Close()
+	}
+	return nil
+}
+
+// dialControl connects to the control pipe of the running instance
+func dialControl(name string) (io.ReadWriteCloser, error) {
+	for attempt := 1; ; attempt++ {
+		file, err := os.OpenFile(name, os.O_RDWR, 0)
+		if err == nil {
+			return file, nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errControlNotRunning
+		}
+		if !errors.Is(err, syscall.Errno(ERROR_PIPE_BUSY)) || attempt == controlDialAttempts {
+			return nil, fmt.Errorf("failed to connect to %s: %w", name, err)
+		}
+		// Every instance is serving a client until Accept creates the next one
+		time.Sleep(50 * time.Millisecond)
+	}
+}
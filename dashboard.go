@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPConfig configures the dashboard and REST API
+type HTTPConfig struct {
+	Address string `json:"address"`         // e.g. 127.0.0.1:8765
+	Token   string `json:"token,omitempty"` // Optional: required unless the address is a loopback address
+}
+
+// dashboardKeepAlive is how often an idle event stream gets a comment, so proxies
+// and clients don't take it for dead
+const dashboardKeepAlive = 30 * time.Second
+
+// dashboardHTML is the page served at /, it reads everything from the REST API
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// dashboardError is the body of failed REST API requests
+type dashboardError struct {
+	Error string `json:"error"`
+}
+
+// isLoopbackHost reports whether a listen host can only be reached from this computer
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// NewDashboardHandler returns the dashboard and REST API for a control handler.
+// Every request under /api needs the token when one is set; the page itself
+// doesn't, it asks for the token instead.
+func NewDashboardHandler(handler ControlHandler, mode string, config *HTTPConfig) http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeDashboardJSON(w, http.StatusOK, newControlStatus(handler, mode))
+	})
+	api.HandleFunc("GET /api/monitors", func(w http.ResponseWriter, r *http.Request) {
+		writeDashboardJSON(w, http.StatusOK, MonitorsOutput{
+			SchemaVersion: OutputSchemaVersion,
+			Monitors:      handler.Status().Monitors,
+		})
+	})
+	api.HandleFunc("GET /api/apps", func(w http.ResponseWriter, r *http.Request) {
+		writeDashboardJSON(w, http.StatusOK, AppsOutput{
+			SchemaVersion: OutputSchemaVersion,
+			ActiveApps:    handler.Status().ActiveApps,
+		})
+	})
+	api.HandleFunc("GET /api/rules", func(w http.ResponseWriter, r *http.Request) {
+		writeDashboardJSON(w, http.StatusOK, RulesOutput{
+			SchemaVersion: OutputSchemaVersion,
+			ActiveProfile: handler.Status().ActiveProfile,
+			Rules:         handler.Rules(),
+		})
+	})
+	api.HandleFunc("GET /api/history", func(w http.ResponseWriter, r *http.Request) {
+		writeDashboardJSON(w, http.StatusOK, HistoryOutput{
+			SchemaVersion: OutputSchemaVersion,
+			History:       handler.History(),
+		})
+	})
+	api.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		streamDashboardEvents(w, r, handler.Events())
+	})
+	api.HandleFunc("POST /api/pause", func(w http.ResponseWriter, r *http.Request) {
+		dashboardAction(w, handler, mode, handler.Pause)
+	})
+	api.HandleFunc("POST /api/resume", func(w http.ResponseWriter, r *http.Request) {
+		dashboardAction(w, handler, mode, handler.Resume)
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardHTML)
+	})
+	mux.Handle("/api/", requireToken(config.Token, api))
+	return guardDashboard(config, mux)
+}
+
+// guardDashboard keeps web pages the browser is showing from using the API. The
+// browser sends their requests without asking when they look like a form
+// submission, and a page can point its own domain at 127.0.0.1 to read the
+// responses (DNS rebinding). Without a token, only requests addressed to this
+// computer or the configured address are accepted. Requests that change
+// something have to come from the dashboard itself and send JSON, which pages
+// on other sites can't do without the browser checking with csres first.
+func guardDashboard(config *HTTPConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.Token == "" && !isDashboardHost(r.Host, config.Address) {
+			writeDashboardJSON(w, http.StatusForbidden, dashboardError{Error: fmt.Sprintf("requests for host %q are not accepted", r.Host)})
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+					writeDashboardJSON(w, http.StatusForbidden, dashboardError{Error: fmt.Sprintf("requests from %s are not accepted", origin)})
+					return
+				}
+			}
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+				writeDashboardJSON(w, http.StatusUnsupportedMediaType, dashboardError{Error: "requests have to send Content-Type: application/json"})
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isDashboardHost reports whether the Host of a request names this computer or the
+// address the dashboard listens on
+func isDashboardHost(host, address string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.Trim(host, "[]")
+	if isLoopbackHost(host) {
+		return true
+	}
+
+	listenHost, _, err := net.SplitHostPort(address)
+	if err != nil || listenHost == "" {
+		return false
+	}
+	if ip := net.ParseIP(listenHost); ip != nil && ip.IsUnspecified() {
+		return false // 0.0.0.0 isn't a name requests are sent to
+	}
+	return strings.EqualFold(host, listenHost)
+}
+
+// requireToken rejects requests that don't carry the token as
+// "Authorization: Bearer <token>". Query parameters would end up in logs.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !bearer {
+			got = ""
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="csres"`)
+			writeDashboardJSON(w, http.StatusUnauthorized, dashboardError{Error: "missing or wrong token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dashboardAction runs a method and responds with the status after it ran
+func dashboardAction(w http.ResponseWriter, handler ControlHandler, mode string, action func() error) {
+	if err := action(); err != nil {
+		writeDashboardJSON(w, http.StatusInternalServerError, dashboardError{Error: err.Error()})
+		return
+	}
+	writeDashboardJSON(w, http.StatusOK, newControlStatus(handler, mode))
+}
+
+// streamDashboardEvents sends events as server-sent events, named after their
+// type, until the client disconnects
+func streamDashboardEvents(w http.ResponseWriter, r *http.Request, hub *EventHub) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeDashboardJSON(w, http.StatusInternalServerError, dashboardError{Error: "streaming is not supported"})
+		return
+	}
+
+	events, cancel := hub.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(dashboardKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				logErrorf("Error encoding %s event: %v", event.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeDashboardJSON writes a REST API response
+func writeDashboardJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		debugf("Dashboard client disconnected: %v", err)
+	}
+}
+
+// StartDashboard serves the dashboard in the background. Failing to listen, e.g.
+// because the port is in use, is returned right away; csres keeps running without it.
+func StartDashboard(config *HTTPConfig, handler ControlHandler, mode string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start dashboard: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           NewDashboardHandler(handler, mode, config),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logErrorf("Error serving dashboard: %v", err)
+		}
+	}()
+
+	log.Printf("Dashboard listening on http://%s/", listener.Addr())
+	return server, nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testToken is the dashboard token used by the tests
+const testToken = "s3cret-token"
+
+// testHTTPConfig is a dashboard config on the default address with the test token
+var testHTTPConfig = &HTTPConfig{Address: "127.0.0.1:8765", Token: testToken}
+
+// fakeControl is a ControlHandler with one monitor and one rule that records
+// whether it is paused
+type fakeControl struct {
+	mu          sync.Mutex
+	paused      bool
+	resumeError error // Returned by Resume when set
+	events      *EventHub
+}
+
+func newFakeControl() *fakeControl {
+	return &fakeControl{events: NewEventHub()}
+}
+
+func (f *fakeControl) Status() EngineStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return EngineStatus{
+		SchemaVersion: OutputSchemaVersion,
+		ConfigFile:    "config.json",
+		Paused:        f.paused,
+		Monitors: []MonitorStatus{
+			{DeviceName: `\\.\DISPLAY1`, Name: "DELL U2719D", Primary: true, Current: &Resolution{Width: 2560, Height: 1440, Frequency: 60}},
+		},
+		ActiveApps: []AppStatus{},
+	}
+}
+
+func (f *fakeControl) Pause() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.paused = true
+	return nil
+}
+
+func (f *fakeControl) Resume() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.resumeError != nil {
+		return f.resumeError
+	}
+	f.paused = false
+	return nil
+}
+
+func (f *fakeControl) Rules() []RuleStatus {
+	return []RuleStatus{{ProcessName: "cs2.exe", Resolution: Resolution{Width: 1280, Height: 960}}}
+}
+
+func (f *fakeControl) Show() error                { return nil }
+func (f *fakeControl) ApplyRule(string) error     { return nil }
+func (f *fakeControl) RestoreAll() error          { return nil }
+func (f *fakeControl) SwitchProfile(string) error { return nil }
+func (f *fakeControl) ReloadConfig() error        { return nil }
+func (f *fakeControl) History() []HistoryEntry    { return []HistoryEntry{} }
+func (f *fakeControl) Events() *EventHub          { return f.events }
+
+// serveDashboard sends one request to the dashboard handler, like the page does:
+// to 127.0.0.1:8765 and with JSON for actions
+func serveDashboard(handler http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Host = "127.0.0.1:8765"
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestDashboardToken(t *testing.T) {
+	handler := NewDashboardHandler(newFakeControl(), "run", testHTTPConfig)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header http.Header
+		want   int
+	}{
+		{"no token", "GET", "/api/status", nil, http.StatusUnauthorized},
+		{"wrong token", "GET", "/api/status", bearer("wrong"), http.StatusUnauthorized},
+		{"token without bearer", "GET", "/api/status", http.Header{"Authorization": {testToken}}, http.StatusUnauthorized},
+		{"query token", "GET", "/api/rules?token=" + testToken, nil, http.StatusUnauthorized},
+		{"actions need the token", "POST", "/api/pause", nil, http.StatusUnauthorized},
+		{"events need the token", "GET", "/api/events", nil, http.StatusUnauthorized},
+		{"bearer token", "GET", "/api/status", bearer(testToken), http.StatusOK},
+		// Other computers use the address they reach csres on
+		{"any host with token", "GET", "http://192.168.1.20:8765/api/status", bearer(testToken), http.StatusOK},
+		{"page without token", "GET", "/", nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveDashboard(handler, tt.method, tt.target, tt.header)
+			if rec.Code != tt.want {
+				t.Fatalf("%s %s: got status %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response without WWW-Authenticate header")
+			}
+		})
+	}
+
+	// Without a token nothing is checked
+	open := NewDashboardHandler(newFakeControl(), "run", &HTTPConfig{Address: "127.0.0.1:8765"})
+	if rec := serveDashboard(open, "GET", "/api/status", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /api/status without a token configured: got status %d, want 200", rec.Code)
+	}
+}
+
+func TestDashboardRejectsOtherSites(t *testing.T) {
+	handler := NewDashboardHandler(newFakeControl(), "run", &HTTPConfig{Address: "127.0.0.1:8765"})
+
+	tests := []struct {
+		name   string
+		method string
+		host   string
+		header http.Header
+		want   int
+	}{
+		{"localhost", "GET", "localhost:8765", nil, http.StatusOK},
+		{"ipv6 loopback", "GET", "[::1]:8765", nil, http.StatusOK},
+		// A page that pointed its domain at 127.0.0.1
+		{"rebound domain", "GET", "attacker.example:8765", nil, http.StatusForbidden},
+		{"same origin action", "POST", "127.0.0.1:8765", http.Header{"Origin": {"http://127.0.0.1:8765"}, "Content-Type": {"application/json"}}, http.StatusOK},
+		{"other origin", "POST", "127.0.0.1:8765", http.Header{"Origin": {"https://attacker.example"}, "Content-Type": {"application/json"}}, http.StatusForbidden},
+		// What an HTML form sends
+		{"form post", "POST", "127.0.0.1:8765", http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}, http.StatusUnsupportedMediaType},
+		{"no content type", "POST", "127.0.0.1:8765", nil, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/status"
+			if tt.method == http.MethodPost {
+				path = "/api/pause"
+			}
+			req := httptest.NewRequest(tt.method, path, nil)
+			req.Host = tt.host
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s for %s: got status %d, want %d", tt.method, path, tt.host, rec.Code, tt.want)
+			}
+		})
+	}
+
+	// The configured address is accepted too
+	lan := NewDashboardHandler(newFakeControl(), "run", &HTTPConfig{Address: "192.168.1.20:8765"})
+	req := httptest.NewRequest("GET", "http://192.168.1.20:8765/api/status", nil)
+	rec := httptest.NewRecorder()
+	lan.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /api/status on the configured address: got status %d, want 200", rec.Code)
+	}
+}
+
+// decodeDashboardStatus decodes a status response
+func decodeDashboardStatus(t *testing.T, rec *httptest.ResponseRecorder) ControlStatus {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type is %q, want application/json", contentType)
+	}
+	var status ControlStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestDashboardStatus(t *testing.T) {
+	handler := NewDashboardHandler(newFakeControl(), "gui", testHTTPConfig)
+
+	status := decodeDashboardStatus(t, serveDashboard(handler, "GET", "/api/status", bearer(testToken)))
+	if status.Mode != "gui" || status.Paused || status.SchemaVersion != OutputSchemaVersion {
+		t.Errorf("got mode %q, paused %v, schema %d; want gui, false, %d", status.Mode, status.Paused, status.SchemaVersion, OutputSchemaVersion)
+	}
+	if len(status.Monitors) != 1 || status.Monitors[0].Current == nil || status.Monitors[0].Current.Width != 2560 {
+		t.Errorf("got monitors %+v, want the fake DISPLAY1 at 2560x1440", status.Monitors)
+	}
+
+	rec := serveDashboard(handler, "GET", "/api/rules", bearer(testToken))
+	var rules RulesOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Rules) != 1 || rules.Rules[0].ProcessName != "cs2.exe" {
+		t.Errorf("got rules %+v, want cs2.exe", rules.Rules)
+	}
+}
+
+func TestDashboardPauseResume(t *testing.T) {
+	control := newFakeControl()
+	handler := NewDashboardHandler(control, "run", testHTTPConfig)
+
+	// Actions respond with the status after they ran
+	if status := decodeDashboardStatus(t, serveDashboard(handler, "POST", "/api/pause", bearer(testToken))); !status.Paused {
+		t.Error("status after POST /api/pause isn't paused")
+	}
+	if status := decodeDashboardStatus(t, serveDashboard(handler, "POST", "/api/resume", bearer(testToken))); status.Paused {
+		t.Error("status after POST /api/resume is still paused")
+	}
+
+	// Reading a status must not change it
+	if rec := serveDashboard(handler, "GET", "/api/pause", bearer(testToken)); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/pause: got status %d, want 405", rec.Code)
+	}
+
+	// Errors are reported in the body
+	control.Pause()
+	control.resumeError = errors.New("failed to start monitoring")
+	rec := serveDashboard(handler, "POST", "/api/resume", bearer(testToken))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("failing POST /api/resume: got status %d, want 500", rec.Code)
+	}
+	var body dashboardError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != "failed to start monitoring" {
+		t.Errorf("got error body %s, want the resume error", rec.Body)
+	}
+}
+
+func TestDashboardEvents(t *testing.T) {
+	control := newFakeControl()
+	server := httptest.NewServer(NewDashboardHandler(control, "run", testHTTPConfig))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content-Type is %q, want text/event-stream", contentType)
+	}
+
+	// The headers are sent once the stream is subscribed, so this event isn't missed
+	control.events.Publish(Event{Type: EventResolutionApplied, ProcessName: "cs2.exe", DeviceName: `\\.\DISPLAY1`, Resolution: &Resolution{Width: 1280, Height: 960}})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var eventType, data string
+	for data == "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("event stream ended before the event arrived")
+			}
+			if name, found := strings.CutPrefix(line, "event: "); found {
+				eventType = name
+			}
+			if payload, found := strings.CutPrefix(line, "data: "); found {
+				data = payload
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+	}
+
+	if eventType != EventResolutionApplied {
+		t.Errorf("event name is %q, want %q", eventType, EventResolutionApplied)
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("decoding event data %s: %v", data, err)
+	}
+	if event.Type != EventResolutionApplied || event.ProcessName != "cs2.exe" || event.Resolution == nil || event.Resolution.Width != 1280 {
+		t.Errorf("got event %+v, want cs2.exe applied 1280x960", event)
+	}
+
+	// Disconnecting unsubscribes the stream
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		control.events.mu.Lock()
+		subscribers := len(control.events.subscribers)
+		control.events.mu.Unlock()
+		if subscribers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("event stream is still subscribed after the client disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
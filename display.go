@@ -2,67 +2,11 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"regexp"
+	"strconv"
 	"strings"
-	"syscall"
-	"unsafe"
 
-	"github.com/StackExchange/wmi"
-)
-
-// DEVMODE represents the Win32 DEVMODE structure
-type DEVMODE struct {
-	DeviceName       [32]uint16
-	SpecVersion      uint16
-	DriverVersion    uint16
-	Size             uint16
-	DriverExtra      uint16
-	Fields           uint32
-	X                int32
-	Y                int32
-	Orientation      uint32
-	FixedOutput      uint32
-	Color            int16
-	Duplex           int16
-	YResolution      int16
-	TTOption         int16
-	Collate          int16
-	FormName         [32]uint16
-	LogPixels        uint16
-	BitsPerPel       uint32
-	PelsWidth        uint32
-	PelsHeight       uint32
-	DisplayFlags     uint32
-	DisplayFrequency uint32
-	ICMMethod        uint32
-	ICMIntent        uint32
-	MediaType        uint32
-	DitherType       uint32
-	Reserved1        uint32
-	Reserved2        uint32
-	PanningWidth     uint32
-	PanningHeight    uint32
-}
-
-// DISPLAY_DEVICE represents the Win32 DISPLAY_DEVICE structure
-type DISPLAY_DEVICE struct {
-	Cb           uint32
-	DeviceName   [32]uint16
-	DeviceString [128]uint16
-	StateFlags   uint32
-	DeviceID     [128]uint16
-	DeviceKey    [128]uint16
-}
-
-const (
-	ENUM_CURRENT_SETTINGS  = 0xFFFFFFFF
-	ENUM_REGISTRY_SETTINGS = 0xFFFFFFFE
-
-	// Display device state flags
-	DISPLAY_DEVICE_ATTACHED_TO_DESKTOP = 0x00000001
-	DISPLAY_DEVICE_PRIMARY_DEVICE      = 0x00000004
-	DISPLAY_DEVICE_ACTIVE              = 0x00000001
+	"csres/edid"
 )
 
 // Win32_PnPEntity represents a WMI PnP entity
@@ -76,286 +20,154 @@ type Win32_PnPEntity struct {
 
 // MonitorInfo represents information about a monitor
 type MonitorInfo struct {
-	DeviceName   string
-	DeviceString string
-	IsPrimary    bool
+	DeviceName       string // Current device name, e.g. \\.\DISPLAY1 (may change after driver updates), or the xrandr output on Linux, e.g. DP-1
+	DeviceString     string // Friendly monitor name
+	MonitorID        string // Monitor DeviceID from the nested EnumDisplayDevicesW call, e.g. MONITOR\DEL40F1\{...}\0001
+	PNPDeviceID      string // PnP device instance ID of the monitor, e.g. DISPLAY\DEL40F1\5&2A3B4C5D&0&UID4353
+	HardwareID       string // EDID manufacturer and product code, e.g. DEL40F1
+	SerialNumber     string // EDID serial number, if reported
+	IsPrimary        bool
+	NativeResolution *Resolution // Preferred timing from the EDID, if reported
 }
 
-// DisplayManager manages display settings
-type DisplayManager struct {
-	user32                       *syscall.DLL
-	procEnumDisplayDevicesW      *syscall.Proc
-	procEnumDisplaySettingsW     *syscall.Proc
-	procChangeDisplaySettingsExW *syscall.Proc
-}
+// monitorNamePattern extracts the model from names like "Generic Monitor (MODEL_NAME)"
+var monitorNamePattern = regexp.MustCompile(`\(([^)]+)\)`)
 
-// NewDisplayManager creates a new DisplayManager instance
-func NewDisplayManager() *DisplayManager {
-	user32 := syscall.MustLoadDLL("user32.dll")
-	return &DisplayManager{
-		user32:                       user32,
-		procEnumDisplayDevicesW:      user32.MustFindProc("EnumDisplayDevicesW"),
-		procEnumDisplaySettingsW:     user32.MustFindProc("EnumDisplaySettingsW"),
-		procChangeDisplaySettingsExW: user32.MustFindProc("ChangeDisplaySettingsExW"),
+// monitorNameFromWMI returns the monitor model name of a WMI PnP entity
+func monitorNameFromWMI(device Win32_PnPEntity) (string, bool) {
+	// Filter for actual monitors (not just display adapters)
+	if !strings.Contains(device.Name, "Monitor") &&
+		!strings.Contains(device.Description, "Monitor") &&
+		!strings.Contains(device.PNPDeviceID, "MONITOR") {
+		return "", false
 	}
-}
-
-// GetAvailableMonitors returns a list of available monitors
-func (dm *DisplayManager) GetAvailableMonitors() ([]MonitorInfo, error) {
-	var monitors []MonitorInfo
-	var displayDevice DISPLAY_DEVICE
-	displayDevice.Cb = uint32(unsafe.Sizeof(displayDevice))
-
-	// Get monitor names from WMI first
-	monitorNames := dm.getMonitorNamesFromWMI()
-
-	for i := uint32(0); ; i++ {
-		ret, _, err := dm.procEnumDisplayDevicesW.Call(
-			uintptr(unsafe.Pointer(nil)),
-			uintptr(i),
-			uintptr(unsafe.Pointer(&displayDevice)),
-			uintptr(0),
-		)
-
-		if err != nil && err != syscall.Errno(0) {
-			return nil, fmt.Errorf("failed to enumerate display devices: %w", err)
-		}
-
-		if ret == 0 {
-			break // No more devices
-		}
 
-		deviceName := syscall.UTF16ToString(displayDevice.DeviceName[:])
-		deviceString := syscall.UTF16ToString(displayDevice.DeviceString[:])
-
-		// Include monitors that are either attached to desktop or active
-		if displayDevice.StateFlags&(DISPLAY_DEVICE_ATTACHED_TO_DESKTOP|DISPLAY_DEVICE_ACTIVE) != 0 {
-			// Get the actual monitor name by enumerating monitors attached to this device
-			monitorName := deviceString // Default to device string if we can't get monitor name
-
-			// Try to get the actual monitor name by enumerating monitors attached to this device
-			var monitorDevice DISPLAY_DEVICE
-			monitorDevice.Cb = uint32(unsafe.Sizeof(monitorDevice))
-
-			for j := uint32(0); ; j++ {
-				ret, _, err := dm.procEnumDisplayDevicesW.Call(
-					uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(deviceName))),
-					uintptr(j),
-					uintptr(unsafe.Pointer(&monitorDevice)),
-					uintptr(0),
-				)
-
-				if err != nil && err != syscall.Errno(0) {
-					break
-				}
-
-				if ret == 0 {
-					break // No more monitors for this device
-				}
-
-				// If this is a monitor (not a GPU), use its name
-				if monitorDevice.StateFlags&DISPLAY_DEVICE_ACTIVE != 0 {
-					// Try to get monitor name from WMI list
-					if len(monitorNames) > 0 {
-						// Use the first available monitor name (simple approach)
-						monitorName = monitorNames[0]
-						// Remove the used name from the list
-						if len(monitorNames) > 1 {
-							monitorNames = monitorNames[1:]
-						}
-						break
-					}
-
-					// Fallback to DeviceString if WMI didn't work
-					monitorNameStr := syscall.UTF16ToString(monitorDevice.DeviceString[:])
-					if monitorNameStr != "" && monitorNameStr != "Generic PnP Monitor" {
-						monitorName = monitorNameStr
-						break
-					}
-				}
-			}
-
-			monitor := MonitorInfo{
-				DeviceName:   deviceName,
-				DeviceString: monitorName, // Use the actual monitor name
-				IsPrimary:    displayDevice.StateFlags&DISPLAY_DEVICE_PRIMARY_DEVICE != 0,
-			}
-
-			monitors = append(monitors, monitor)
-		}
+	matches := monitorNamePattern.FindStringSubmatch(device.Name)
+	if len(matches) < 2 {
+		return "", false
 	}
 
-	return monitors, nil
-}
-
-// GetCurrentResolution retrieves the current display resolution for primary monitor
-func (dm *DisplayManager) GetCurrentResolution() (*Resolution, error) {
-	return dm.GetCurrentResolutionForMonitor("")
+	return matches[1], true
 }
 
-// GetCurrentResolutionForMonitor retrieves the current display resolution for a specific monitor
-func (dm *DisplayManager) GetCurrentResolutionForMonitor(monitorName string) (*Resolution, error) {
-	var devMode DEVMODE
-	devMode.Size = uint16(unsafe.Sizeof(devMode))
-
-	// Convert monitorName to UTF16 pointer
-	var monitorNamePtr *uint16
-	if monitorName != "" {
-		monitorNameUtf16, err := syscall.UTF16PtrFromString(monitorName)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert monitor name to UTF16: %w", err)
-		}
-		monitorNamePtr = monitorNameUtf16
+// pnpDeviceIDFromInterfacePath converts a monitor device interface path to its PnP device instance ID,
+// e.g. `\\?\DISPLAY#DEL40F1#5&2a3b4c5d&0&UID4353#{e6f07b5f-...}` -> `DISPLAY\DEL40F1\5&2A3B4C5D&0&UID4353`
+func pnpDeviceIDFromInterfacePath(interfacePath string) string {
+	instancePath := strings.TrimPrefix(interfacePath, `\\?\`)
+	if idx := strings.LastIndex(instancePath, "#{"); idx != -1 {
+		instancePath = instancePath[:idx] // Strip the device interface class GUID
 	}
 
-	ret, _, err := dm.procEnumDisplaySettingsW.Call(
-		uintptr(unsafe.Pointer(monitorNamePtr)),
-		uintptr(ENUM_CURRENT_SETTINGS),
-		uintptr(unsafe.Pointer(&devMode)),
-	)
-
-	if ret == 0 {
-		if err != nil {
-			return nil, fmt.Errorf("failed to get display settings: %w", err)
-		}
-		return nil, fmt.Errorf("failed to get display settings")
+	if !strings.Contains(instancePath, "#") {
+		return ""
 	}
 
-	return &Resolution{
-		Width:     uint32(devMode.PelsWidth),
-		Height:    uint32(devMode.PelsHeight),
-		Frequency: uint32(devMode.DisplayFrequency),
-	}, nil
+	return strings.ToUpper(strings.ReplaceAll(instancePath, "#", `\`))
 }
 
-// GetAvailableResolutions returns a list of available resolutions for a monitor
-func (dm *DisplayManager) GetAvailableResolutions(monitorName string) ([]Resolution, error) {
-	var resolutions []Resolution
-	var devMode DEVMODE
-	devMode.Size = uint16(unsafe.Sizeof(devMode))
+// assignWMIMonitorNames sets the friendly names of monitors from WMI PnP entities.
+// Monitors are correlated by PnP device instance ID. If a monitor's instance is not
+// found, its manufacturer/product code is used as long as exactly one entity has it.
+func assignWMIMonitorNames(monitors []MonitorInfo, devices []Win32_PnPEntity) {
+	namesByInstance := make(map[string]string)
+	namesByHardwareID := make(map[string][]string)
 
-	// Convert monitorName to UTF16 pointer
-	var monitorNamePtr *uint16
-	if monitorName != "" {
-		monitorNameUtf16, err := syscall.UTF16PtrFromString(monitorName)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert monitor name to UTF16: %w", err)
+	for _, device := range devices {
+		name, ok := monitorNameFromWMI(device)
+		if !ok {
+			continue
 		}
-		monitorNamePtr = monitorNameUtf16
-	}
 
-	// Enumerate all display settings
-	for modeNum := uint32(0); ; modeNum++ {
-		ret, _, _ := dm.procEnumDisplaySettingsW.Call(
-			uintptr(unsafe.Pointer(monitorNamePtr)),
-			uintptr(modeNum),
-			uintptr(unsafe.Pointer(&devMode)),
-		)
-
-		if ret == 0 {
-			break // No more modes
-		}
+		instanceID := strings.ToUpper(device.PNPDeviceID)
+		namesByInstance[instanceID] = name
 
-		resolution := Resolution{
-			Width:     uint32(devMode.PelsWidth),
-			Height:    uint32(devMode.PelsHeight),
-			Frequency: uint32(devMode.DisplayFrequency),
-		}
+		hardwareID := hardwareIDFromMonitorID(instanceID)
+		namesByHardwareID[hardwareID] = append(namesByHardwareID[hardwareID], name)
+	}
 
-		// Check if this resolution is already in the list
-		isDuplicate := false
-		for _, r := range resolutions {
-			if r.Width == resolution.Width && r.Height == resolution.Height && r.Frequency == resolution.Frequency {
-				isDuplicate = true
-				break
-			}
+	for i := range monitors {
+		if name, exists := namesByInstance[strings.ToUpper(monitors[i].PNPDeviceID)]; exists && monitors[i].PNPDeviceID != "" {
+			monitors[i].DeviceString = name
+			continue
 		}
 
-		if !isDuplicate {
-			resolutions = append(resolutions, resolution)
+		hardwareID := strings.ToUpper(hardwareIDFromMonitorID(monitors[i].MonitorID))
+		if names := namesByHardwareID[hardwareID]; hardwareID != "" && len(names) == 1 {
+			monitors[i].DeviceString = names[0]
 		}
 	}
-
-	return resolutions, nil
 }
 
-// SetResolution changes the display resolution for a specific monitor
-func (dm *DisplayManager) SetResolution(monitorName string, resolution Resolution) error {
-	var devMode DEVMODE
-	devMode.Size = uint16(unsafe.Sizeof(devMode))
-	devMode.Fields = 0x00180000 // DM_PELSWIDTH | DM_PELSHEIGHT | DM_DISPLAYFREQUENCY
-	devMode.PelsWidth = uint32(resolution.Width)
-	devMode.PelsHeight = uint32(resolution.Height)
-	devMode.DisplayFrequency = uint32(resolution.Frequency)
-
-	// Convert monitorName to UTF16 pointer
-	var monitorNamePtr *uint16
-	if monitorName != "" {
-		monitorNameUtf16, err := syscall.UTF16PtrFromString(monitorName)
-		if err != nil {
-			return fmt.Errorf("failed to convert monitor name to UTF16: %w", err)
-		}
-		monitorNamePtr = monitorNameUtf16
+// applyMonitorDevice fills in what EnumDisplayDevicesW reports about the monitor
+// attached to a display: its device ID, name and device interface path
+func applyMonitorDevice(monitor *MonitorInfo, monitorID, monitorName, interfacePath string) {
+	monitor.MonitorID = monitorID
+	if monitorName != "" && monitorName != "Generic PnP Monitor" {
+		monitor.DeviceString = monitorName
 	}
+	if interfacePath != "" {
+		monitor.PNPDeviceID = pnpDeviceIDFromInterfacePath(interfacePath)
+	}
+}
 
-	// Try to change the display settings
-	const maxRetries = 3
-	var lastError error
+// applyEDID fills in the monitor details decoded from its EDID
+func applyEDID(monitor *MonitorInfo, info *edid.EDID) {
+	monitor.HardwareID = info.HardwareID()
+	monitor.SerialNumber = info.Serial()
 
-	for i := 0; i < maxRetries; i++ {
-		ret, _, err := dm.procChangeDisplaySettingsExW.Call(
-			uintptr(unsafe.Pointer(monitorNamePtr)),
-			uintptr(unsafe.Pointer(&devMode)),
-			0,
-			0,
-			0,
-		)
+	if info.MonitorName != "" {
+		monitor.DeviceString = info.MonitorName
+	}
 
-		if ret == 0 {
-			return nil // Success
+	if timing := info.PreferredTiming; timing != nil {
+		monitor.NativeResolution = &Resolution{
+			Width:     uint32(timing.HActive),
+			Height:    uint32(timing.VActive),
+			Frequency: timing.RefreshRate(),
 		}
-
-		lastError = err
-		log.Printf("Attempt %d to change resolution failed: %v", i+1, err)
 	}
+}
 
-	return fmt.Errorf("failed to change resolution after %d attempts. Last error: %v", maxRetries, lastError)
+// IsResolutionEqual compares two resolutions for equality
+func IsResolutionEqual(r1, r2 Resolution) bool {
+	return r1.Width == r2.Width && r1.Height == r2.Height && r1.Frequency == r2.Frequency
 }
 
-// getMonitorNamesFromWMI gets all monitor names using WMI
-func (dm *DisplayManager) getMonitorNamesFromWMI() []string {
-	var monitorNames []string
+// ParseResolution parses a mode written as WIDTHxHEIGHT or WIDTHxHEIGHT@HZ, e.g.
+// 1280x960@144. Without a refresh rate the frequency is 0 (keep the current rate).
+func ParseResolution(mode string) (Resolution, error) {
+	invalid := fmt.Errorf("invalid mode %q, expected WIDTHxHEIGHT[@HZ] like 1280x960@144", mode)
 
-	// Query WMI for monitor devices
-	var devices []Win32_PnPEntity
-	query := `SELECT Name, Description, DeviceID, PNPDeviceID, Status FROM Win32_PnPEntity WHERE PNPDeviceID LIKE "%DISPLAY%"`
-	err := wmi.Query(query, &devices)
-	if err != nil {
-		log.Printf("WMI query failed: %v", err)
-		return monitorNames
+	size, rate, hasRate := strings.Cut(strings.TrimSuffix(strings.ToLower(mode), "hz"), "@")
+	widthText, heightText, ok := strings.Cut(size, "x")
+	if !ok {
+		return Resolution{}, invalid
 	}
 
-	for _, device := range devices {
-		// Filter for actual monitors (not just display adapters)
-		if strings.Contains(device.Name, "Monitor") ||
-			strings.Contains(device.Description, "Monitor") ||
-			strings.Contains(device.PNPDeviceID, "MONITOR") {
+	width, err := strconv.ParseUint(widthText, 10, 32)
+	if err != nil || width == 0 {
+		return Resolution{}, invalid
+	}
+	height, err := strconv.ParseUint(heightText, 10, 32)
+	if err != nil || height == 0 {
+		return Resolution{}, invalid
+	}
 
-			// Extract the monitor name from parentheses
-			// Format is typically: "Generic Monitor (MODEL_NAME)"
-			re := regexp.MustCompile(`\(([^)]+)\)`)
-			matches := re.FindStringSubmatch(device.Name)
-			if len(matches) >= 2 {
-				monitorName := matches[1]
-				monitorNames = append(monitorNames, monitorName)
-			}
+	res := Resolution{Width: uint32(width), Height: uint32(height)}
+	if hasRate {
+		frequency, err := strconv.ParseUint(rate, 10, 32)
+		if err != nil {
+			return Resolution{}, invalid
 		}
+		res.Frequency = uint32(frequency)
 	}
-
-	return monitorNames
+	return res, nil
 }
 
-// IsResolutionEqual compares two resolutions for equality
-func IsResolutionEqual(r1, r2 Resolution) bool {
-	return r1.Width == r2.Width && r1.Height == r2.Height && r1.Frequency == r2.Frequency
+// FormatResolution writes a mode the way ParseResolution reads it
+func FormatResolution(res Resolution) string {
+	if res.Frequency == 0 {
+		return fmt.Sprintf("%dx%d", res.Width, res.Height)
+	}
+	return fmt.Sprintf("%dx%d@%dHz", res.Width, res.Height, res.Frequency)
 }
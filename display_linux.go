@@ -0,0 +1,536 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"csres/edid"
+)
+
+// xrandrOutput is an output listed by xrandr, e.g. DP-1
+type xrandrOutput struct {
+	Name      string
+	Connected bool
+	Primary   bool
+	Active    bool // Shows part of the screen, a monitor that is connected but turned off doesn't
+	Modes     []xrandrMode
+}
+
+// xrandrMode is one refresh rate of a mode listed for an output
+type xrandrMode struct {
+	Name       string     // Mode name passed to --mode, e.g. 1920x1080 or 1280x960_144.00
+	Rate       string     // Refresh rate passed to --rate, e.g. 143.97
+	Resolution Resolution // The refresh rate is rounded to whole hertz
+	Current    bool
+	Preferred  bool
+}
+
+// xrandrModeSizePattern reads the size from a mode name. Interlaced modes end in "i".
+var xrandrModeSizePattern = regexp.MustCompile(`^(\d+)x(\d+)(i?)`)
+
+// xrandrGeometryPattern matches the position of an active output, e.g. 2560x1440+0+0
+var xrandrGeometryPattern = regexp.MustCompile(`^\d+x\d+[+-]\d+[+-]\d+$`)
+
+// deviceNameExample shows what device names look like in messages
+const deviceNameExample = "DP-1"
+
+// isDeviceName reports whether a monitor name can be an xrandr output name like
+// DP-1. Output names vary by driver, so anything without spaces or a colon is
+// accepted; rules for outputs that don't exist only cause a warning.
+func isDeviceName(monitorName string) bool {
+	return monitorName != "" && !strings.ContainsAny(monitorName, " \t:")
+}
+
+// DisplayManager manages display settings through xrandr, which needs an X11
+// session or XWayland
+type DisplayManager struct {
+	dryRun    bool                  // Record mode changes instead of applying them
+	simulated map[string]Resolution // map of monitor name to the mode set in dry-run mode
+}
+
+// NewDisplayManager creates a new DisplayManager instance
+func NewDisplayManager() *DisplayManager {
+	return &DisplayManager{}
+}
+
+// SetPersistent has no effect on Linux: modes set with xrandr last until the X
+// session ends, csres restores them when it exits
+func (dm *DisplayManager) SetPersistent(persistent bool) {}
+
+// SetDynamic has no effect on Linux, see SetPersistent
+func (dm *DisplayManager) SetDynamic(dynamic bool) {}
+
+// SetDryRun makes SetResolution record changes instead of applying them. The
+// recorded modes are reported as the current ones, so callers behave as if the
+// changes had been made.
+func (dm *DisplayManager) SetDryRun(dryRun bool) {
+	dm.dryRun = dryRun
+	dm.simulated = make(map[string]Resolution)
+}
+
+// GetAvailableMonitors returns a list of available monitors
+func (dm *DisplayManager) GetAvailableMonitors() ([]MonitorInfo, error) {
+	outputs, err := dm.queryOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	monitors := monitorsFromOutputs(outputs)
+	applySysfsEDIDs(monitors, outputs)
+
+	// Without an EDID the mode the driver prefers is the native one
+	for i, output := range activeOutputs(outputs) {
+		if monitors[i].NativeResolution != nil {
+			continue
+		}
+		for _, mode := range output.Modes {
+			if mode.Preferred {
+				native := mode.Resolution
+				monitors[i].NativeResolution = &native
+				break
+			}
+		}
+	}
+	return monitors, nil
+}
+
+// enumerateDisplays lists the active outputs and the monitors connected to them.
+// Unlike GetAvailableMonitors it doesn't look up the native resolutions.
+func (dm *DisplayManager) enumerateDisplays() ([]MonitorInfo, error) {
+	outputs, err := dm.queryOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	monitors := monitorsFromOutputs(outputs)
+	applySysfsEDIDs(monitors, outputs)
+	return monitors, nil
+}
+
+// GetCurrentResolution retrieves the current display resolution for primary monitor
+func (dm *DisplayManager) GetCurrentResolution() (*Resolution, error) {
+	return dm.GetCurrentResolutionForMonitor("")
+}
+
+// GetCurrentResolutionForMonitor retrieves the current display resolution for a specific monitor
+func (dm *DisplayManager) GetCurrentResolutionForMonitor(monitorName string) (*Resolution, error) {
+	if res, simulated := dm.simulated[monitorName]; dm.dryRun && simulated {
+		return &res, nil
+	}
+
+	output, err := dm.findOutput(monitorName)
+	if err != nil {
+		return nil, err
+	}
+	for _, mode := range output.Modes {
+		if mode.Current {
+			res := mode.Resolution
+			return &res, nil
+		}
+	}
+	return nil, fmt.Errorf("xrandr doesn't report the current mode of %s", output.Name)
+}
+
+// GetRegistryResolutionForMonitor exists for Windows, X11 doesn't store a mode
+// to apply at sign-in
+func (dm *DisplayManager) GetRegistryResolutionForMonitor(monitorName string) (*Resolution, error) {
+	return nil, errors.New("stored modes are only available on Windows")
+}
+
+// queryWMIMonitors exists for Windows, there is no WMI to ask for the monitors' names
+func (dm *DisplayManager) queryWMIMonitors() []Win32_PnPEntity {
+	return nil
+}
+
+// GetAvailableResolutions returns a list of available resolutions for a monitor
+func (dm *DisplayManager) GetAvailableResolutions(monitorName string) ([]Resolution, error) {
+	output, err := dm.findOutput(monitorName)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolutions []Resolution
+	for _, mode := range output.Modes {
+		isDuplicate := false
+		for _, r := range resolutions {
+			if IsResolutionEqual(r, mode.Resolution) {
+				isDuplicate = true
+				break
+			}
+		}
+		if !isDuplicate {
+			resolutions = append(resolutions, mode.Resolution)
+		}
+	}
+	return resolutions, nil
+}
+
+// SetResolution changes the display resolution for a specific monitor
+func (dm *DisplayManager) SetResolution(monitorName string, resolution Resolution) error {
+	if dm.dryRun {
+		dm.simulated[monitorName] = resolution
+		return nil
+	}
+
+	output, err := dm.findOutput(monitorName)
+	if err != nil {
+		return err
+	}
+	mode, ok := selectXrandrMode(output.Modes, resolution)
+	if !ok {
+		return fmt.Errorf("%s doesn't support %s", output.Name, FormatResolution(resolution))
+	}
+
+	if _, err := runXrandr("--output", output.Name, "--mode", mode.Name, "--rate", mode.Rate); err != nil {
+		return fmt.Errorf("failed to change resolution: %w", err)
+	}
+	return nil
+}
+
+// queryOutputs lists the outputs and their modes. --current reads the state the X
+// server already knows instead of probing the outputs again, which can make
+// monitors flicker.
+func (dm *DisplayManager) queryOutputs() ([]xrandrOutput, error) {
+	out, err := runXrandr("--current")
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate display devices: %w", err)
+	}
+	return parseXrandr(out), nil
+}
+
+// findOutput returns the active output with the given name, the primary one for ""
+func (dm *DisplayManager) findOutput(monitorName string) (*xrandrOutput, error) {
+	outputs, err := dm.queryOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	active := activeOutputs(outputs)
+	if monitorName == "" {
+		if primary := primaryOutput(active); primary != nil {
+			return primary, nil
+		}
+		return nil, errors.New("no active monitor")
+	}
+	for i := range active {
+		if strings.EqualFold(active[i].Name, monitorName) {
+			return &active[i], nil
+		}
+	}
+	return nil, fmt.Errorf("monitor %s is not connected or turned off", monitorName)
+}
+
+// runXrandr runs xrandr and returns its output, or its error message if it fails
+func runXrandr(args ...string) (string, error) {
+	out, err := exec.Command("xrandr", args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return "", fmt.Errorf("xrandr: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// parseXrandr reads the outputs and modes from the output of xrandr --query or
+// --current. Mode lines list every refresh rate of a mode, "*" marks the current
+// one and "+" the preferred one, e.g. "   1920x1080     60.00*+  59.94". Interlaced
+// modes are left out.
+func parseXrandr(text string) []xrandrOutput {
+	var outputs []xrandrOutput
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "Screen" {
+			continue
+		}
+
+		// Output lines start in the first column, mode lines are indented
+		if line[0] != ' ' && line[0] != '\t' {
+			if len(fields) < 2 {
+				continue
+			}
+			output := xrandrOutput{Name: fields[0], Connected: fields[1] == "connected"}
+			for _, field := range fields[2:] {
+				switch {
+				case field == "primary":
+					output.Primary = true
+				case xrandrGeometryPattern.MatchString(field):
+					output.Active = true
+				}
+			}
+			outputs = append(outputs, output)
+			continue
+		}
+
+		if len(outputs) == 0 {
+			continue
+		}
+		size := xrandrModeSizePattern.FindStringSubmatch(fields[0])
+		if size == nil || size[3] == "i" {
+			continue
+		}
+		width, _ := strconv.ParseUint(size[1], 10, 32)
+		height, _ := strconv.ParseUint(size[2], 10, 32)
+
+		output := &outputs[len(outputs)-1]
+		for _, field := range fields[1:] {
+			// xrandr pads rates that aren't current: "60.00 +" is the preferred rate
+			if field == "+" {
+				if n := len(output.Modes); n > 0 && output.Modes[n-1].Name == fields[0] {
+					output.Modes[n-1].Preferred = true
+				}
+				continue
+			}
+
+			rate := strings.TrimRight(field, "*+")
+			hz, err := strconv.ParseFloat(rate, 64)
+			if err != nil {
+				continue
+			}
+			output.Modes = append(output.Modes, xrandrMode{
+				Name:       fields[0],
+				Rate:       rate,
+				Resolution: Resolution{Width: uint32(width), Height: uint32(height), Frequency: uint32(math.Round(hz))},
+				Current:    strings.Contains(field, "*"),
+				Preferred:  strings.Contains(field, "+"),
+			})
+		}
+	}
+	return outputs
+}
+
+// activeOutputs returns the outputs that are connected and show part of the screen
+func activeOutputs(outputs []xrandrOutput) []xrandrOutput {
+	var active []xrandrOutput
+	for _, output := range outputs {
+		if output.Connected && output.Active {
+			active = append(active, output)
+		}
+	}
+	return active
+}
+
+// primaryOutput returns the primary output. Without one marked primary, X11 treats
+// the first active output as the primary one.
+func primaryOutput(active []xrandrOutput) *xrandrOutput {
+	for i := range active {
+		if active[i].Primary {
+			return &active[i]
+		}
+	}
+	if len(active) > 0 {
+		return &active[0]
+	}
+	return nil
+}
+
+// monitorsFromOutputs describes the active outputs as monitors, named after the output
+func monitorsFromOutputs(outputs []xrandrOutput) []MonitorInfo {
+	active := activeOutputs(outputs)
+	primary := primaryOutput(active)
+
+	monitors := make([]MonitorInfo, 0, len(active))
+	for i, output := range active {
+		monitors = append(monitors, MonitorInfo{
+			DeviceName:   output.Name,
+			DeviceString: output.Name,
+			IsPrimary:    &active[i] == primary,
+		})
+	}
+	return monitors
+}
+
+// applySysfsEDIDs fills in the details of the monitors from the EDIDs the kernel
+// exposes for its DRM connectors. The monitor ID names the connector, e.g.
+// DRM\DEL40F1\card0-DP-1, so a different monitor on the same output is noticed.
+func applySysfsEDIDs(monitors []MonitorInfo, outputs []xrandrOutput) {
+	blobs, err := edid.FromSysfs()
+	if err != nil {
+		debugf("Reading EDIDs from sysfs failed: %v", err)
+		return
+	}
+	connectors := matchDRMConnectors(outputs, blobs)
+
+	for i := range monitors {
+		connector, ok := connectors[monitors[i].DeviceName]
+		if !ok {
+			continue
+		}
+		info, err := edid.Parse(blobs[connector])
+		if err != nil {
+			debugf("Invalid EDID for %s: %v", connector, err)
+			continue
+		}
+		applyEDID(&monitors[i], info)
+		monitors[i].MonitorID = `DRM\` + info.HardwareID() + `\` + connector
+	}
+}
+
+// matchDRMConnectors finds the DRM connector of each active output, e.g.
+// card0-DP-1 for DP-1. Outputs whose name doesn't match a single connector are
+// paired with the only remaining connector of the same type, if there is one.
+func matchDRMConnectors(outputs []xrandrOutput, connectors map[string][]byte) map[string]string {
+	var names []string
+	for _, output := range outputs {
+		names = append(names, output.Name)
+	}
+	zeroBased := xrandrCountsFromZero(names)
+
+	kernelNames := make(map[string]string)
+	for _, output := range activeOutputs(outputs) {
+		kernelNames[output.Name] = kernelConnectorName(output.Name, zeroBased)
+	}
+
+	matched := make(map[string]string)
+	used := make(map[string]bool)
+
+	// With several GPUs the same name can exist on more than one card, it is then
+	// left to the type match
+	for output, kernelName := range kernelNames {
+		var found []string
+		for connector := range connectors {
+			if strings.EqualFold(drmConnectorName(connector), kernelName) {
+				found = append(found, connector)
+			}
+		}
+		if len(found) == 1 {
+			matched[output] = found[0]
+			used[found[0]] = true
+		}
+	}
+
+	for output, kernelName := range kernelNames {
+		if _, ok := matched[output]; ok {
+			continue
+		}
+		kind := connectorType(kernelName)
+
+		outputsOfKind := 0
+		for other, otherName := range kernelNames {
+			if _, ok := matched[other]; !ok && connectorType(otherName) == kind {
+				outputsOfKind++
+			}
+		}
+		var connectorsOfKind []string
+		for connector := range connectors {
+			if !used[connector] && connectorType(drmConnectorName(connector)) == kind {
+				connectorsOfKind = append(connectorsOfKind, connector)
+			}
+		}
+		if outputsOfKind == 1 && len(connectorsOfKind) == 1 {
+			matched[output] = connectorsOfKind[0]
+			used[connectorsOfKind[0]] = true
+		}
+	}
+	return matched
+}
+
+// xrandrCountsFromZero reports whether the driver numbers its outputs from 0, like
+// amdgpu (DisplayPort-0) and nvidia (DP-0) do, while the kernel counts from 1.
+// xrandr lists disconnected outputs too, so the first of each type is there.
+func xrandrCountsFromZero(outputs []string) bool {
+	for _, name := range outputs {
+		if strings.HasSuffix(name, "-0") {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelConnectorName converts an xrandr output name to the name the kernel uses
+// for the connector, e.g. HDMI-1 (modesetting) or HDMI-A-0 (amdgpu) to HDMI-A-1
+// and DisplayPort-0 to DP-1
+func kernelConnectorName(output string, zeroBased bool) string {
+	kind := connectorType(output)
+	number, err := strconv.Atoi(output[strings.LastIndex(output, "-")+1:])
+	if err != nil {
+		return strings.ToUpper(output)
+	}
+
+	switch kind {
+	case "DISPLAYPORT":
+		kind = "DP"
+	case "HDMI":
+		kind = "HDMI-A"
+	}
+	if zeroBased {
+		number++
+	}
+	return kind + "-" + strconv.Itoa(number)
+}
+
+// drmConnectorName removes the card from a DRM connector name: card0-DP-1 -> DP-1
+func drmConnectorName(connector string) string {
+	if _, name, ok := strings.Cut(connector, "-"); ok {
+		return name
+	}
+	return connector
+}
+
+// connectorType returns the type of a connector name: DP-1 -> DP
+func connectorType(name string) string {
+	if i := strings.LastIndex(name, "-"); i != -1 {
+		return strings.ToUpper(name[:i])
+	}
+	return strings.ToUpper(name)
+}
+
+// selectXrandrMode finds the mode to set for a resolution. Refresh rates are
+// compared in whole hertz; without a refresh rate the current rate is kept if the
+// mode supports it, otherwise the preferred or first one is used.
+func selectXrandrMode(modes []xrandrMode, res Resolution) (xrandrMode, bool) {
+	var current *xrandrMode
+	for i := range modes {
+		if modes[i].Current {
+			current = &modes[i]
+		}
+	}
+
+	var candidates []xrandrMode
+	for _, mode := range modes {
+		if mode.Resolution.Width != res.Width || mode.Resolution.Height != res.Height {
+			continue
+		}
+		if res.Frequency == 0 || mode.Resolution.Frequency == res.Frequency {
+			candidates = append(candidates, mode)
+		}
+	}
+	if len(candidates) == 0 {
+		return xrandrMode{}, false
+	}
+
+	if res.Frequency == 0 {
+		for _, mode := range candidates {
+			if current != nil && mode.Resolution.Frequency == current.Resolution.Frequency {
+				return mode, true
+			}
+		}
+		for _, mode := range candidates {
+			if mode.Preferred {
+				return mode, true
+			}
+		}
+		return candidates[0], true
+	}
+
+	// 60 Hz matches both 60.00 and 59.94, take the closest
+	best := candidates[0]
+	for _, mode := range candidates[1:] {
+		if rateDistance(mode, res.Frequency) < rateDistance(best, res.Frequency) {
+			best = mode
+		}
+	}
+	return best, true
+}
+
+// rateDistance returns how far the exact refresh rate of a mode is from a whole rate
+func rateDistance(mode xrandrMode, frequency uint32) float64 {
+	hz, _ := strconv.ParseFloat(mode.Rate, 64)
+	return math.Abs(hz - float64(frequency))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// readXrandrFixture parses a recording of xrandr --current
+func readXrandrFixture(t *testing.T, name string) []xrandrOutput {
+	t.Helper()
+	data, err := os.ReadFile("testdata/xrandr/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseXrandr(string(data))
+}
+
+func TestParseXrandr(t *testing.T) {
+	outputs := readXrandrFixture(t, "two-monitors.txt")
+	if len(outputs) != 4 {
+		t.Fatalf("got %d outputs, want 4", len(outputs))
+	}
+
+	monitors := monitorsFromOutputs(outputs)
+	if len(monitors) != 2 || monitors[0].DeviceName != "DisplayPort-0" || monitors[1].DeviceName != "HDMI-A-0" {
+		t.Fatalf("got monitors %+v, want the two active outputs", monitors)
+	}
+	if !monitors[0].IsPrimary || monitors[1].IsPrimary {
+		t.Errorf("got primary %v, %v, want DisplayPort-0", monitors[0].IsPrimary, monitors[1].IsPrimary)
+	}
+
+	// The interlaced mode is left out
+	if modes := outputs[0].Modes; len(modes) != 9 {
+		t.Errorf("got %d modes for DisplayPort-0, want 9", len(modes))
+	}
+
+	tests := []struct {
+		output    int
+		current   Resolution
+		preferred Resolution
+	}{
+		{0, Resolution{Width: 2560, Height: 1440, Frequency: 144}, Resolution{Width: 2560, Height: 1440, Frequency: 144}},
+		// The preferred rate isn't the current one: "60.00 +"
+		{1, Resolution{Width: 1920, Height: 1080, Frequency: 75}, Resolution{Width: 1920, Height: 1080, Frequency: 60}},
+	}
+	for _, tt := range tests {
+		var current, preferred Resolution
+		for _, mode := range outputs[tt.output].Modes {
+			if mode.Current {
+				current = mode.Resolution
+			}
+			if mode.Preferred {
+				preferred = mode.Resolution
+			}
+		}
+		if current != tt.current || preferred != tt.preferred {
+			t.Errorf("%s: got current %v and preferred %v, want %v and %v", outputs[tt.output].Name, current, preferred, tt.current, tt.preferred)
+		}
+	}
+}
+
+func TestSelectXrandrMode(t *testing.T) {
+	outputs := readXrandrFixture(t, "two-monitors.txt")
+
+	tests := []struct {
+		output   int
+		res      Resolution
+		wantMode string
+		wantRate string
+	}{
+		{0, Resolution{Width: 1920, Height: 1080, Frequency: 144}, "1920x1080", "143.98"},
+		// 60 Hz is closer to 60.00 than to 59.94
+		{0, Resolution{Width: 1920, Height: 1080, Frequency: 60}, "1920x1080", "60.00"},
+		{0, Resolution{Width: 1280, Height: 960}, "1280x960", "60.00"},
+		// Without a refresh rate the current one is kept when the mode has it
+		{0, Resolution{Width: 2560, Height: 1440}, "2560x1440", "143.97"},
+		{1, Resolution{Width: 1280, Height: 720}, "1280x720", "60.00"},
+		{0, Resolution{Width: 1280, Height: 720}, "", ""},
+		{0, Resolution{Width: 1920, Height: 1080, Frequency: 75}, "", ""},
+	}
+	for _, tt := range tests {
+		mode, ok := selectXrandrMode(outputs[tt.output].Modes, tt.res)
+		if ok != (tt.wantMode != "") || mode.Name != tt.wantMode || mode.Rate != tt.wantRate {
+			t.Errorf("%s %s: got %q at %q (%v), want %q at %q", outputs[tt.output].Name, FormatResolution(tt.res), mode.Name, mode.Rate, ok, tt.wantMode, tt.wantRate)
+		}
+	}
+}
+
+func TestMatchDRMConnectors(t *testing.T) {
+	// Only the connectors of connected monitors have an EDID
+	output := func(name string, active bool) xrandrOutput {
+		return xrandrOutput{Name: name, Connected: active, Active: active}
+	}
+
+	tests := []struct {
+		name       string
+		outputs    []xrandrOutput
+		connectors []string
+		want       map[string]string
+	}{
+		{
+			name:       "amdgpu counts from 0",
+			outputs:    readXrandrFixture(t, "two-monitors.txt"),
+			connectors: []string{"card0-DP-1", "card0-HDMI-A-1"},
+			want:       map[string]string{"DisplayPort-0": "card0-DP-1", "HDMI-A-0": "card0-HDMI-A-1"},
+		},
+		{
+			name:       "modesetting",
+			outputs:    []xrandrOutput{output("eDP-1", true), output("DP-1", false), output("HDMI-1", true)},
+			connectors: []string{"card1-eDP-1", "card1-HDMI-A-1"},
+			want:       map[string]string{"eDP-1": "card1-eDP-1", "HDMI-1": "card1-HDMI-A-1"},
+		},
+		{
+			// nvidia numbers DisplayPort outputs across the card, the only DP connector is paired
+			name:       "names differ",
+			outputs:    []xrandrOutput{output("DP-0", false), output("DP-1", false), output("DP-4", true), output("HDMI-0", true)},
+			connectors: []string{"card1-DP-3", "card1-HDMI-A-1"},
+			want:       map[string]string{"DP-4": "card1-DP-3", "HDMI-0": "card1-HDMI-A-1"},
+		},
+		{
+			// Two GPUs with the same connector, there is no telling which one it is
+			name:       "ambiguous",
+			outputs:    []xrandrOutput{output("DP-1", true)},
+			connectors: []string{"card0-DP-1", "card1-DP-1"},
+			want:       map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connectors := make(map[string][]byte)
+			for _, connector := range tt.connectors {
+				connectors[connector] = nil
+			}
+			got := matchDRMConnectors(tt.outputs, connectors)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for output, connector := range tt.want {
+				if got[output] != connector {
+					t.Errorf("%s: got connector %q, want %q", output, got[output], connector)
+				}
+			}
+		})
+	}
+}
+
+func TestIsDeviceName(t *testing.T) {
+	for _, name := range []string{"DP-1", "HDMI-A-0", "eDP-1", `\\.\DISPLAY1`} {
+		if !isDeviceName(name) {
+			t.Errorf("isDeviceName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"", "Dell U2720Q", "id:DEL4321"} {
+		if isDeviceName(name) {
+			t.Errorf("isDeviceName(%q) = true, want false", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// displayFixture is a recording of what EnumDisplayDevicesW and the WMI query
+// returned on a machine, with the monitor names csres should show for it
+type displayFixture struct {
+	Description string `json:"description"`
+	Displays    []struct {
+		Adapter struct {
+			DeviceName   string
+			DeviceString string
+			StateFlags   uint32
+		} `json:"adapter"`
+		Monitor struct {
+			DeviceID     string
+			DeviceString string
+		} `json:"monitor"`
+		Interface struct {
+			DeviceID string
+		} `json:"interface"` // Queried with EDD_GET_DEVICE_INTERFACE_NAME
+	} `json:"displays"`
+	WMI  []Win32_PnPEntity `json:"wmi"`
+	Want []string          `json:"want"` // Name of each display, in order
+}
+
+// fixturePrimaryDevice is DISPLAY_DEVICE_PRIMARY_DEVICE, which is only defined on
+// Windows, the fixtures are read on every platform
+const fixturePrimaryDevice = 0x4
+
+func TestAssignWMIMonitorNames(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "display", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures in testdata/display")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture displayFixture
+			if err := json.Unmarshal(data, &fixture); err != nil {
+				t.Fatal(err)
+			}
+
+			var monitors []MonitorInfo
+			for _, display := range fixture.Displays {
+				monitor := MonitorInfo{
+					DeviceName:   display.Adapter.DeviceName,
+					DeviceString: display.Adapter.DeviceString,
+					IsPrimary:    display.Adapter.StateFlags&fixturePrimaryDevice != 0,
+				}
+				applyMonitorDevice(&monitor, display.Monitor.DeviceID, display.Monitor.DeviceString, display.Interface.DeviceID)
+				monitors = append(monitors, monitor)
+			}
+
+			assignWMIMonitorNames(monitors, fixture.WMI)
+
+			if len(monitors) != len(fixture.Want) {
+				t.Fatalf("got %d monitors, fixture wants %d names", len(monitors), len(fixture.Want))
+			}
+			for i, monitor := range monitors {
+				if monitor.DeviceString != fixture.Want[i] {
+					t.Errorf("%s: got name %q, want %q (%s)", monitor.DeviceName, monitor.DeviceString, fixture.Want[i], fixture.Description)
+				}
+			}
+		})
+	}
+}
+
+func TestPNPDeviceIDFromInterfacePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`\\?\DISPLAY#DEL40F1#5&2a3b4c5d&0&UID4353#{e6f07b5f-ee97-4a90-b076-33f57bf4eaa7}`, `DISPLAY\DEL40F1\5&2A3B4C5D&0&UID4353`},
+		{`\\?\DISPLAY#GSM5B7F#5&2a3b4c5d&0&UID4354`, `DISPLAY\GSM5B7F\5&2A3B4C5D&0&UID4354`},
+		{`DISPLAY#AUO82ED#4&8c3a1b2&0&UID8388688#{e6f07b5f-ee97-4a90-b076-33f57bf4eaa7}`, `DISPLAY\AUO82ED\4&8C3A1B2&0&UID8388688`},
+		{`MONITOR\DEL40F1\{4d36e96e-e325-11ce-bfc1-08002be10318}\0001`, ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := pnpDeviceIDFromInterfacePath(tt.path); got != tt.want {
+			t.Errorf("pnpDeviceIDFromInterfacePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
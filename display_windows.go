@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"csres/edid"
+
+	"github.com/StackExchange/wmi"
+)
+
+// DEVMODE represents the Win32 DEVMODE structure
+type DEVMODE struct {
+	DeviceName       [32]uint16
+	SpecVersion      uint16
+	DriverVersion    uint16
+	Size             uint16
+	DriverExtra      uint16
+	Fields           uint32
+	X                int32
+	Y                int32
+	Orientation      uint32
+	FixedOutput      uint32
+	Color            int16
+	Duplex           int16
+	YResolution      int16
+	TTOption         int16
+	Collate          int16
+	FormName         [32]uint16
+	LogPixels        uint16
+	BitsPerPel       uint32
+	PelsWidth        uint32
+	PelsHeight       uint32
+	DisplayFlags     uint32
+	DisplayFrequency uint32
+	ICMMethod        uint32
+	ICMIntent        uint32
+	MediaType        uint32
+	DitherType       uint32
+	Reserved1        uint32
+	Reserved2        uint32
+	PanningWidth     uint32
+	PanningHeight    uint32
+}
+
+// DISPLAY_DEVICE represents the Win32 DISPLAY_DEVICE structure
+type DISPLAY_DEVICE struct {
+	Cb           uint32
+	DeviceName   [32]uint16
+	DeviceString [128]uint16
+	StateFlags   uint32
+	DeviceID     [128]uint16
+	DeviceKey    [128]uint16
+}
+
+const (
+	ENUM_CURRENT_SETTINGS  = 0xFFFFFFFF
+	ENUM_REGISTRY_SETTINGS = 0xFFFFFFFE
+
+	// Display device state flags
+	DISPLAY_DEVICE_ATTACHED_TO_DESKTOP = 0x00000001
+	DISPLAY_DEVICE_PRIMARY_DEVICE      = 0x00000004
+	DISPLAY_DEVICE_ACTIVE              = 0x00000001
+
+	// EnumDisplayDevices flags
+	EDD_GET_DEVICE_INTERFACE_NAME = 0x00000001
+
+	// ChangeDisplaySettingsEx flags
+	CDS_UPDATEREGISTRY = 0x00000001 // Persist the mode in the registry
+	CDS_FULLSCREEN     = 0x00000004 // Temporary mode, reverted by Windows when csres exits
+)
+
+// deviceNameExample shows what device names look like in messages
+const deviceNameExample = `\\.\DISPLAY1`
+
+// isDeviceName reports whether a monitor name is a device name like \\.\DISPLAY1
+func isDeviceName(monitorName string) bool {
+	return strings.HasPrefix(monitorName, `\\.\`)
+}
+
+// DisplayManager manages display settings
+type DisplayManager struct {
+	user32                       *syscall.DLL
+	procEnumDisplayDevicesW      *syscall.Proc
+	procEnumDisplaySettingsW     *syscall.Proc
+	procChangeDisplaySettingsExW *syscall.Proc
+	persistent                   bool                  // Write mode changes to the registry instead of applying them temporarily
+	dynamic                      bool                  // Apply mode changes so they outlive the process, without writing the registry
+	dryRun                       bool                  // Record mode changes instead of applying them
+	simulated                    map[string]Resolution // map of monitor name to the mode set in dry-run mode
+}
+
+// NewDisplayManager creates a new DisplayManager instance
+func NewDisplayManager() *DisplayManager {
+	user32 := syscall.MustLoadDLL("user32.dll")
+	return &DisplayManager{
+		user32:                       user32,
+		procEnumDisplayDevicesW:      user32.MustFindProc("EnumDisplayDevicesW"),
+		procEnumDisplaySettingsW:     user32.MustFindProc("EnumDisplaySettingsW"),
+		procChangeDisplaySettingsExW: user32.MustFindProc("ChangeDisplaySettingsExW"),
+	}
+}
+
+// SetPersistent selects between temporary (CDS_FULLSCREEN) and persistent
+// (CDS_UPDATEREGISTRY) resolution changes. Temporary changes are reverted by
+// Windows automatically if csres exits without restoring them.
+func (dm *DisplayManager) SetPersistent(persistent bool) {
+	dm.persistent = persistent
+}
+
+// SetDynamic makes changes that aren't persistent last until the user signs out
+// instead of being reverted when csres exits. Used by csres set, which exits right
+// after changing the mode.
+func (dm *DisplayManager) SetDynamic(dynamic bool) {
+	dm.dynamic = dynamic
+}
+
+// SetDryRun makes SetResolution record changes instead of applying them. The
+// recorded modes are reported as the current ones, so callers behave as if the
+// changes had been made.
+func (dm *DisplayManager) SetDryRun(dryRun bool) {
+	dm.dryRun = dryRun
+	dm.simulated = make(map[string]Resolution)
+}
+
+// changeFlags returns the ChangeDisplaySettingsEx flags for the current mode
+func (dm *DisplayManager) changeFlags() uintptr {
+	if dm.persistent {
+		return CDS_UPDATEREGISTRY
+	}
+	if dm.dynamic {
+		return 0
+	}
+	return CDS_FULLSCREEN
+}
+
+// GetAvailableMonitors returns a list of available monitors
+func (dm *DisplayManager) GetAvailableMonitors() ([]MonitorInfo, error) {
+	monitors, err := dm.enumerateDisplays()
+	if err != nil {
+		return nil, err
+	}
+
+	// Attach friendly names from WMI by matching the monitors' PnP device IDs
+	assignWMIMonitorNames(monitors, dm.queryWMIMonitors())
+
+	// The EDID has the real model name, serial number and native mode
+	for i := range monitors {
+		if monitors[i].PNPDeviceID == "" {
+			continue
+		}
+
+		data, err := edid.FromRegistry(monitors[i].PNPDeviceID)
+		if err != nil {
+			continue // Not every monitor has an EDID stored
+		}
+
+		info, err := edid.Parse(data)
+		if err != nil {
+			logWarnf("Warning: failed to parse EDID for monitor %s: %v", monitors[i].DeviceName, err)
+			continue
+		}
+
+		applyEDID(&monitors[i], info)
+	}
+
+	return monitors, nil
+}
+
+// enumerateDisplays lists the displays attached to the desktop and the monitors
+// showing them. Unlike GetAvailableMonitors it doesn't query WMI or the EDID.
+func (dm *DisplayManager) enumerateDisplays() ([]MonitorInfo, error) {
+	var monitors []MonitorInfo
+	var displayDevice DISPLAY_DEVICE
+	displayDevice.Cb = uint32(unsafe.Sizeof(displayDevice))
+
+	for i := uint32(0); ; i++ {
+		ret, _, err := dm.procEnumDisplayDevicesW.Call(
+			uintptr(unsafe.Pointer(nil)),
+			uintptr(i),
+			uintptr(unsafe.Pointer(&displayDevice)),
+			uintptr(0),
+		)
+
+		if err != nil && err != syscall.Errno(0) {
+			return nil, fmt.Errorf("failed to enumerate display devices: %w", err)
+		}
+
+		if ret == 0 {
+			break // No more devices
+		}
+
+		// Include monitors that are either attached to desktop or active
+		if displayDevice.StateFlags&(DISPLAY_DEVICE_ATTACHED_TO_DESKTOP|DISPLAY_DEVICE_ACTIVE) != 0 {
+			monitor := MonitorInfo{
+				DeviceName:   syscall.UTF16ToString(displayDevice.DeviceName[:]),
+				DeviceString: syscall.UTF16ToString(displayDevice.DeviceString[:]), // Default to device string if we can't get monitor name
+				IsPrimary:    displayDevice.StateFlags&DISPLAY_DEVICE_PRIMARY_DEVICE != 0,
+			}
+
+			dm.describeAttachedMonitor(&monitor)
+			monitors = append(monitors, monitor)
+		}
+	}
+
+	return monitors, nil
+}
+
+// describeAttachedMonitor fills in the identity of the first active monitor attached to a display device
+func (dm *DisplayManager) describeAttachedMonitor(monitor *MonitorInfo) {
+	deviceNamePtr, err := syscall.UTF16PtrFromString(monitor.DeviceName)
+	if err != nil {
+		return
+	}
+
+	var monitorDevice DISPLAY_DEVICE
+	monitorDevice.Cb = uint32(unsafe.Sizeof(monitorDevice))
+
+	for j := uint32(0); ; j++ {
+		ret, _, err := dm.procEnumDisplayDevicesW.Call(
+			uintptr(unsafe.Pointer(deviceNamePtr)),
+			uintptr(j),
+			uintptr(unsafe.Pointer(&monitorDevice)),
+			uintptr(0),
+		)
+
+		if err != nil && err != syscall.Errno(0) {
+			return
+		}
+
+		if ret == 0 {
+			return // No more monitors for this device
+		}
+
+		// Skip inactive entries, we want the monitor that is actually showing this display
+		if monitorDevice.StateFlags&DISPLAY_DEVICE_ACTIVE == 0 {
+			continue
+		}
+
+		// Query the same monitor again for its device interface path, which identifies the PnP device instance
+		var interfaceDevice DISPLAY_DEVICE
+		interfaceDevice.Cb = uint32(unsafe.Sizeof(interfaceDevice))
+		interfacePath := ""
+		ret, _, _ = dm.procEnumDisplayDevicesW.Call(
+			uintptr(unsafe.Pointer(deviceNamePtr)),
+			uintptr(j),
+			uintptr(unsafe.Pointer(&interfaceDevice)),
+			uintptr(EDD_GET_DEVICE_INTERFACE_NAME),
+		)
+		if ret != 0 {
+			interfacePath = syscall.UTF16ToString(interfaceDevice.DeviceID[:])
+		}
+
+		applyMonitorDevice(monitor, syscall.UTF16ToString(monitorDevice.DeviceID[:]), syscall.UTF16ToString(monitorDevice.DeviceString[:]), interfacePath)
+		return
+	}
+}
+
+// GetCurrentResolution retrieves the current display resolution for primary monitor
+func (dm *DisplayManager) GetCurrentResolution() (*Resolution, error) {
+	return dm.GetCurrentResolutionForMonitor("")
+}
+
+// GetCurrentResolutionForMonitor retrieves the current display resolution for a specific monitor
+func (dm *DisplayManager) GetCurrentResolutionForMonitor(monitorName string) (*Resolution, error) {
+	if res, simulated := dm.simulated[monitorName]; dm.dryRun && simulated {
+		return &res, nil
+	}
+
+	return dm.displaySettings(monitorName, ENUM_CURRENT_SETTINGS)
+}
+
+// GetRegistryResolutionForMonitor retrieves the mode stored in the registry for a
+// monitor, which Windows applies at sign-in
+func (dm *DisplayManager) GetRegistryResolutionForMonitor(monitorName string) (*Resolution, error) {
+	return dm.displaySettings(monitorName, ENUM_REGISTRY_SETTINGS)
+}
+
+// displaySettings reads the current or registry mode of a monitor
+func (dm *DisplayManager) displaySettings(monitorName string, modeNum uint32) (*Resolution, error) {
+	var devMode DEVMODE
+	devMode.Size = uint16(unsafe.Sizeof(devMode))
+
+	// Convert monitorName to UTF16 pointer
+	var monitorNamePtr *uint16
+	if monitorName != "" {
+		monitorNameUtf16, err := syscall.UTF16PtrFromString(monitorName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert monitor name to UTF16: %w", err)
+		}
+		monitorNamePtr = monitorNameUtf16
+	}
+
+	ret, _, err := dm.procEnumDisplaySettingsW.Call(
+		uintptr(unsafe.Pointer(monitorNamePtr)),
+		uintptr(modeNum),
+		uintptr(unsafe.Pointer(&devMode)),
+	)
+
+	if ret == 0 {
+		if err != nil {
+			return nil, fmt.Errorf("failed to get display settings: %w", err)
+		}
+		return nil, fmt.Errorf("failed to get display settings")
+	}
+
+	return &Resolution{
+		Width:     uint32(devMode.PelsWidth),
+		Height:    uint32(devMode.PelsHeight),
+		Frequency: uint32(devMode.DisplayFrequency),
+	}, nil
+}
+
+// GetAvailableResolutions returns a list of available resolutions for a monitor
+func (dm *DisplayManager) GetAvailableResolutions(monitorName string) ([]Resolution, error) {
+	var resolutions []Resolution
+	var devMode DEVMODE
+	devMode.Size = uint16(unsafe.Sizeof(devMode))
+
+	// Convert monitorName to UTF16 pointer
+	var monitorNamePtr *uint16
+	if monitorName != "" {
+		monitorNameUtf16, err := syscall.UTF16PtrFromString(monitorName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert monitor name to UTF16: %w", err)
+		}
+		monitorNamePtr = monitorNameUtf16
+	}
+
+	// Enumerate all display settings
+	for modeNum := uint32(0); ; modeNum++ {
+		ret, _, _ := dm.procEnumDisplaySettingsW.Call(
+			uintptr(unsafe.Pointer(monitorNamePtr)),
+			uintptr(modeNum),
+			uintptr(unsafe.Pointer(&devMode)),
+		)
+
+		if ret == 0 {
+			break // No more modes
+		}
+
+		resolution := Resolution{
+			Width:     uint32(devMode.PelsWidth),
+			Height:    uint32(devMode.PelsHeight),
+			Frequency: uint32(devMode.DisplayFrequency),
+		}
+
+		// Check if this resolution is already in the list
+		isDuplicate := false
+		for _, r := range resolutions {
+			if r.Width == resolution.Width && r.Height == resolution.Height && r.Frequency == resolution.Frequency {
+				isDuplicate = true
+				break
+			}
+		}
+
+		if !isDuplicate {
+			resolutions = append(resolutions, resolution)
+		}
+	}
+
+	return resolutions, nil
+}
+
+// SetResolution changes the display resolution for a specific monitor
+func (dm *DisplayManager) SetResolution(monitorName string, resolution Resolution) error {
+	if dm.dryRun {
+		dm.simulated[monitorName] = resolution
+		return nil
+	}
+
+	var devMode DEVMODE
+	devMode.Size = uint16(unsafe.Sizeof(devMode))
+	devMode.Fields = 0x00180000 // DM_PELSWIDTH | DM_PELSHEIGHT | DM_DISPLAYFREQUENCY
+	devMode.PelsWidth = uint32(resolution.Width)
+	devMode.PelsHeight = uint32(resolution.Height)
+	devMode.DisplayFrequency = uint32(resolution.Frequency)
+
+	// Convert monitorName to UTF16 pointer
+	var monitorNamePtr *uint16
+	if monitorName != "" {
+		monitorNameUtf16, err := syscall.UTF16PtrFromString(monitorName)
+		if err != nil {
+			return fmt.Errorf("failed to convert monitor name to UTF16: %w", err)
+		}
+		monitorNamePtr = monitorNameUtf16
+	}
+
+	// Try to change the display settings
+	const maxRetries = 3
+	var lastError error
+
+	for i := 0; i < maxRetries; i++ {
+		ret, _, err := dm.procChangeDisplaySettingsExW.Call(
+			uintptr(unsafe.Pointer(monitorNamePtr)),
+			uintptr(unsafe.Pointer(&devMode)),
+			0,
+			dm.changeFlags(),
+			0,
+		)
+
+		if ret == 0 {
+			return nil // Success
+		}
+
+		lastError = err
+		logWarnf("Attempt %d to change resolution failed: %v", i+1, err)
+	}
+
+	return fmt.Errorf("failed to change resolution after %d attempts. Last error: %v", maxRetries, lastError)
+}
+
+// queryWMIMonitors gets all display PnP entities using WMI
+func (dm *DisplayManager) queryWMIMonitors() []Win32_PnPEntity {
+	var devices []Win32_PnPEntity
+	query := `SELECT Name, Description, DeviceID, PNPDeviceID, Status FROM Win32_PnPEntity WHERE PNPDeviceID LIKE "%DISPLAY%"`
+	if err := wmi.Query(query, &devices); err != nil {
+		logWarnf("WMI query failed: %v", err)
+		return nil
+	}
+
+	return devices
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"csres/version"
+)
+
+// doctorLogLines is the number of recent log lines included in a support bundle
+const doctorLogLines = 200
+
+// doctorCommand collects everything needed to look into a problem into a single
+// JSON file that can be attached to a bug report
+func doctorCommand() *command {
+	var output string
+	return &command{
+		name:    "doctor",
+		args:    "[config-file]",
+		summary: "Write a support bundle with monitors, modes, config, startup state and recent log lines",
+		flags: func(fs *flag.FlagSet, opts *commandOptions) {
+			fs.StringVar(&output, "output", "", "file to write the bundle to, - for standard output (default: csres-doctor-<date>-<time>.json)")
+		},
+		run: func(opts *commandOptions, args []string) error {
+			if err := expectArgs(args, 0, 1); err != nil {
+				return err
+			}
+
+			report := collectDoctorReport(opts, args)
+			data, err := encodeDoctorReport(report)
+			if err != nil {
+				return err
+			}
+
+			if opts.jsonOutput || output == "-" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			if output == "" {
+				output = fmt.Sprintf("csres-doctor-%s.json", report.GeneratedAt.Format("20060102-150405"))
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("failed to write support bundle: %w", err)
+			}
+
+			printDoctorSummary(report)
+			if path, err := filepath.Abs(output); err == nil {
+				output = path
+			}
+			fmt.Printf("\nWrote support bundle to %s\n", output)
+			fmt.Println("Usernames were removed from paths, check the file before sharing it.")
+			return nil
+		},
+	}
+}
+
+// collectDoctorReport gathers the support bundle. Failures are recorded in the
+// report instead of stopping it, a partial report is still useful.
+func collectDoctorReport(opts *commandOptions, args []string) *DoctorReport {
+	report := &DoctorReport{
+		SchemaVersion: OutputSchemaVersion,
+		GeneratedAt:   time.Now(),
+		Version:       version.Get(),
+		Monitors:      []DoctorMonitor{},
+		WMIDevices:    []DoctorWMIDevice{},
+		Log:           []string{},
+		Problems:      []string{},
+	}
+
+	displayManager := NewDisplayManager()
+	inventory, err := loadInventory(displayManager)
+	var monitors []MonitorInfo
+	if err != nil {
+		report.problem("%v", err)
+	} else {
+		monitors = inventory.Monitors()
+	}
+
+	for _, monitor := range monitors {
+		item := DoctorMonitor{
+			MonitorStatus: newMonitorStatus(monitor),
+			MonitorID:     monitor.MonitorID,
+			PNPDeviceID:   monitor.PNPDeviceID,
+			HardwareID:    monitor.HardwareID,
+			SerialNumber:  monitor.SerialNumber,
+		}
+		if res, err := displayManager.GetCurrentResolutionForMonitor(monitor.DeviceName); err == nil {
+			item.Current = res
+		} else {
+			report.problem("failed to get resolution for monitor %s: %v", monitor.DeviceName, err)
+		}
+		// Only Windows stores a mode to apply at sign-in
+		if runtime.GOOS == "windows" {
+			if res, err := displayManager.GetRegistryResolutionForMonitor(monitor.DeviceName); err == nil {
+				item.Registry = res
+			} else {
+				report.problem("failed to get registry mode for monitor %s: %v", monitor.DeviceName, err)
+			}
+		}
+		if modes, err := displayManager.GetAvailableResolutions(monitor.DeviceName); err == nil {
+			sortResolutions(modes)
+			item.Modes = modes
+		} else {
+			report.problem("failed to get modes of monitor %s: %v", monitor.DeviceName, err)
+		}
+		report.Monitors = append(report.Monitors, item)
+	}
+
+	for _, device := range displayManager.queryWMIMonitors() {
+		report.WMIDevices = append(report.WMIDevices, DoctorWMIDevice{
+			Name:        device.Name,
+			Description: device.Description,
+			DeviceID:    device.DeviceID,
+			PNPDeviceID: device.PNPDeviceID,
+			Status:      device.Status,
+		})
+	}
+	if len(report.WMIDevices) == 0 && runtime.GOOS == "windows" {
+		report.problem("WMI reported no display devices, monitor names fall back to the driver's")
+	}
+
+	report.collectConfig(opts, args, monitors)
+
+	report.Startup.Command, report.Startup.Registered = startupCommand()
+
+	if path, err := logFilePath(); err != nil {
+		report.problem("%v", err)
+	} else {
+		report.LogFile = path
+		if lines, err := recentLogLines(path, doctorLogLines); err != nil {
+			report.problem("%v", err)
+		} else if lines != nil {
+			report.Log = lines
+		}
+	}
+
+	return report
+}
+
+// collectConfig adds the config file, its layers and the result of validating it
+func (r *DoctorReport) collectConfig(opts *commandOptions, args []string, monitors []MonitorInfo) {
+	r.Config.Issues = []ValidateIssue{}
+	r.Config.Files = []DoctorConfigFile{}
+
+	explicit := opts.configFile
+	if len(args) > 0 {
+		explicit = args[0]
+	}
+	configFile, source, err := LocateConfigPath(explicit)
+	if err != nil {
+		r.Config.Error = fmt.Sprintf("failed to locate config file: %v", err)
+		r.problem("%s", r.Config.Error)
+		return
+	}
+	r.Config.Path = configFile
+	r.Config.Source = source
+
+	config, err := LoadConfig(configFile)
+	if err == nil && monitors != nil {
+		err = ValidateConfigMonitors(config, monitors)
+	}
+	result := validateResult(configFile, err)
+	r.Config.Valid = result.Valid
+	r.Config.Error = result.Error
+	r.Config.Issues = result.Issues
+	var tokens []string
+	if config != nil {
+		r.Config.ActiveProfile = config.ActiveProfile
+		r.Config.Effective = withoutToken(config)
+		if config.HTTP != nil {
+			tokens = append(tokens, config.HTTP.Token)
+		}
+	}
+
+	for _, file := range ConfigLayerFiles(configFile) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			r.problem("failed to read config file %s: %v", file, err)
+			continue
+		}
+		r.Config.Files = append(r.Config.Files, DoctorConfigFile{Path: file, Content: redactTokens(file, data, tokens)})
+	}
+}
+
+// redactedToken replaces the dashboard token in support bundles
+const redactedToken = "<redacted>"
+
+// withoutToken returns a copy of a config with the dashboard token replaced
+func withoutToken(config *Config) *Config {
+	if config.HTTP == nil || config.HTTP.Token == "" {
+		return config
+	}
+	http := *config.HTTP
+	http.Token = redactedToken
+	redacted := *config
+	redacted.HTTP = &http
+	return &redacted
+}
+
+// redactTokens returns the content of a config file with the dashboard token it
+// sets replaced, along with the given tokens, e.g. the one of the merged config
+// for files that can't be parsed
+func redactTokens(filename string, data []byte, tokens []string) string {
+	if doc, err := parseConfigDocument(filename, data); err == nil {
+		if http, ok := doc.tree["http"].(map[string]any); ok {
+			if token, ok := http["token"].(string); ok {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	content := string(data)
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		// Only whole values are replaced, a short token could be part of other text
+		value := regexp.MustCompile(`(^|[\s"':=])` + regexp.QuoteMeta(token) + `($|[\s"',}#])`)
+		content = value.ReplaceAllString(content, "${1}"+redactedToken+"${2}")
+	}
+	return content
+}
+
+// problem records information that could not be collected
+func (r *DoctorReport) problem(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	logWarnf("Warning: %s", message)
+	r.Problems = append(r.Problems, message)
+}
+
+// encodeDoctorReport converts a report to indented JSON with usernames removed
+func encodeDoctorReport(report *DoctorReport) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // Keep config file contents readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return nil, fmt.Errorf("failed to encode support bundle: %w", err)
+	}
+	return newUserRedactor().Redact(buf.Bytes()), nil
+}
+
+// printDoctorSummary prints the main findings of a report
+func printDoctorSummary(report *DoctorReport) {
+	fmt.Printf("Version:  %s\n", report.Version)
+
+	state := "valid"
+	switch {
+	case report.Config.Error != "":
+		state = report.Config.Error
+	case !report.Config.Valid:
+		state = fmt.Sprintf("%d problems", len(report.Config.Issues))
+	}
+	fmt.Printf("Config:   %s (%s)\n", report.Config.Path, state)
+
+	startup := "not registered"
+	if report.Startup.Registered {
+		startup = "registered"
+	}
+	fmt.Printf("Startup:  %s\n", startup)
+
+	fmt.Println("Monitors:")
+	if len(report.Monitors) == 0 {
+		fmt.Println("  none")
+	}
+	for _, monitor := range report.Monitors {
+		current := "unknown mode"
+		if monitor.Current != nil {
+			current = FormatResolution(*monitor.Current)
+		}
+		fmt.Printf("  %s: %s - %s, %d modes\n", monitor.DeviceName, monitor.Name, current, len(monitor.Modes))
+	}
+
+	if len(report.Problems) > 0 {
+		fmt.Println("Problems:")
+		for _, problem := range report.Problems {
+			fmt.Printf("  %s\n", problem)
+		}
+	}
+}
+
+// userRedactor replaces the home directory and name of the current user in text
+type userRedactor struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+}
+
+// newUserRedactor creates a redactor for the current user
+func newUserRedactor() *userRedactor {
+	r := &userRedactor{}
+
+	// Home directories are replaced first so paths stay recognizable
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		for _, form := range []string{
+			home,
+			strings.ReplaceAll(home, `\`, `\\`), // As escaped in JSON strings
+			strings.ReplaceAll(home, `\`, "/"),
+		} {
+			r.add(`(?i)`+regexp.QuoteMeta(form), "%USERPROFILE%")
+		}
+	}
+
+	for _, name := range currentUserNames() {
+		r.addUserName(name)
+	}
+	return r
+}
+
+// addUserName replaces a user name where it is a whole path segment, e.g. in
+// C:\Users\name or DESKTOP-1234\name. Short names like "admin" also appear in
+// ordinary words and values, which are left alone.
+func (r *userRedactor) addUserName(name string) {
+	r.add(`(?im)([\\/])`+regexp.QuoteMeta(name)+`([\\/"'\s]|$)`, "${1}<user>${2}")
+}
+
+// add registers a pattern and its replacement, which may refer to groups as ${1}
+func (r *userRedactor) add(pattern, replacement string) {
+	r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	r.replacements = append(r.replacements, replacement)
+}
+
+// Redact returns the text with the user's home directory and name replaced
+func (r *userRedactor) Redact(data []byte) []byte {
+	for i, pattern := range r.patterns {
+		data = pattern.ReplaceAll(data, []byte(r.replacements[i]))
+	}
+	return data
+}
+
+// currentUserNames returns the names the current user may appear under in paths
+func currentUserNames() []string {
+	var names []string
+	add := func(name string) {
+		// Account names may include the domain, e.g. DESKTOP-1234\name
+		if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+			name = name[i+1:]
+		}
+		if name == "" {
+			return
+		}
+		for _, existing := range names {
+			if strings.EqualFold(existing, name) {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+
+	add(os.Getenv("USERNAME"))
+	add(os.Getenv("USER"))
+	if current, err := user.Current(); err == nil {
+		add(current.Username)
+	}
+	// The profile directory may be named differently from the account
+	if home, err := os.UserHomeDir(); err == nil {
+		add(filepath.Base(home))
+	}
+	return names
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactTokens(t *testing.T) {
+	tests := []struct {
+		file   string
+		data   string
+		tokens []string
+	}{
+		{"config.json", `{"http": {"address": "0.0.0.0:8765", "token": "s3cret"}}`, nil},
+		{"config.yaml", "http:\n  address: 0.0.0.0:8765\n  token: s3cret # for the phone\n", nil},
+		{"config.toml", "[http]\naddress = \"0.0.0.0:8765\"\ntoken = 's3cret'\n", nil},
+		// Files that can't be parsed still lose the token of the merged config
+		{"config.user.json", `{"http": {"token": "s3cret",}`, []string{"s3cret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got := redactTokens(tt.file, []byte(tt.data), tt.tokens)
+			if want := strings.ReplaceAll(tt.data, "s3cret", redactedToken); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	// Only whole values are replaced
+	data := `{"applications": [{"process_name": "cs2.exe"}], "http": {"token": "cs2"}}`
+	want := `{"applications": [{"process_name": "cs2.exe"}], "http": {"token": "<redacted>"}}`
+	if got := redactTokens("config.json", []byte(data), nil); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWithoutToken(t *testing.T) {
+	config := &Config{HTTP: &HTTPConfig{Address: "0.0.0.0:8765", Token: "s3cret"}}
+
+	redacted := withoutToken(config)
+	if redacted.HTTP.Token != redactedToken || redacted.HTTP.Address != "0.0.0.0:8765" {
+		t.Errorf("got http %+v, want the token redacted", *redacted.HTTP)
+	}
+	if config.HTTP.Token != "s3cret" {
+		t.Error("withoutToken changed the config it was given")
+	}
+}
+
+func TestRedactUserName(t *testing.T) {
+	r := &userRedactor{}
+	r.addUserName("admin")
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`C:\Users\admin\AppData\Roaming\csres`, `C:\Users\<user>\AppData\Roaming\csres`},
+		{`{"path": "C:\\Users\\Admin\\csres.log"}`, `{"path": "C:\\Users\\<user>\\csres.log"}`},
+		{"/home/admin", "/home/<user>"},
+		{"account DESKTOP-1234\\admin signed in", "account DESKTOP-1234\\<user> signed in"},
+		// Outside of paths the name is left alone
+		{"the admin account has administrator rights", "the admin account has administrator rights"},
+		{`{"role": "admin"}`, `{"role": "admin"}`},
+		{`C:\Users\administrator`, `C:\Users\administrator`},
+	}
+
+	for _, tt := range tests {
+		if got := string(r.Redact([]byte(tt.text))); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package edid decodes Extended Display Identification Data (EDID) blocks
+// reported by monitors.
+package edid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	blockSize      = 128
+	descriptorSize = 18
+
+	// Display descriptor tags
+	tagSerialNumber = 0xFF
+	tagMonitorName  = 0xFC
+
+	// Extension block tags
+	tagCEAExtension = 0x02
+)
+
+var header = []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+// ErrInvalid is returned (wrapped) for data that is not a valid EDID block
+var ErrInvalid = errors.New("invalid EDID")
+
+// DetailedTiming represents a detailed timing descriptor
+type DetailedTiming struct {
+	PixelClock uint32 // Pixel clock in kHz
+	HActive    uint16 // Horizontal active pixels
+	HBlank     uint16 // Horizontal blanking pixels
+	VActive    uint16 // Vertical active lines
+	VBlank     uint16 // Vertical blanking lines
+	Interlaced bool
+	WidthMM    uint16 // Image width in millimetres
+	HeightMM   uint16 // Image height in millimetres
+}
+
+// RefreshRate returns the vertical refresh rate in Hz, rounded to the nearest integer
+func (t DetailedTiming) RefreshRate() uint32 {
+	total := uint64(t.HActive+t.HBlank) * uint64(t.VActive+t.VBlank)
+	if total == 0 {
+		return 0
+	}
+	return uint32((uint64(t.PixelClock)*1000 + total/2) / total)
+}
+
+// EDID represents the decoded contents of an EDID base block and its extensions
+type EDID struct {
+	ManufacturerID  string // Three-letter PnP manufacturer ID, e.g. "DEL"
+	ProductCode     uint16
+	SerialNumber    uint32 // Numeric serial number from the base block (0 if unused)
+	SerialString    string // Serial number from the display descriptor, if present
+	MonitorName     string // Monitor name from the display descriptor, if present
+	Week            uint8
+	Year            int
+	Version         uint8
+	Revision        uint8
+	PreferredTiming *DetailedTiming  // Native mode of the monitor, if reported
+	DetailedTimings []DetailedTiming // All detailed timings, including the preferred one
+}
+
+// HardwareID returns the manufacturer and product code as used in Windows
+// device IDs, e.g. "DEL40F1"
+func (e *EDID) HardwareID() string {
+	return fmt.Sprintf("%s%04X", e.ManufacturerID, e.ProductCode)
+}
+
+// Serial returns the serial number, preferring the descriptor string over the numeric field
+func (e *EDID) Serial() string {
+	if e.SerialString != "" {
+		return e.SerialString
+	}
+	if e.SerialNumber != 0 {
+		return fmt.Sprintf("%d", e.SerialNumber)
+	}
+	return ""
+}
+
+// Parse decodes an EDID blob. Extension blocks are optional; CEA-861 extensions
+// contribute additional detailed timings.
+func Parse(data []byte) (*EDID, error) {
+	if len(data) < blockSize {
+		return nil, fmt.Errorf("%w: need %d bytes, got %d", ErrInvalid, blockSize, len(data))
+	}
+
+	base := data[:blockSize]
+	for i, b := range header {
+		if base[i] != b {
+			return nil, fmt.Errorf("%w: bad header", ErrInvalid)
+		}
+	}
+	if !validChecksum(base) {
+		return nil, fmt.Errorf("%w: base block checksum mismatch", ErrInvalid)
+	}
+
+	e := &EDID{
+		ManufacturerID: decodeManufacturerID(binary.BigEndian.Uint16(base[8:10])),
+		ProductCode:    binary.LittleEndian.Uint16(base[10:12]),
+		SerialNumber:   binary.LittleEndian.Uint32(base[12:16]),
+		Week:           base[16],
+		Year:           int(base[17]) + 1990,
+		Version:        base[18],
+		Revision:       base[19],
+	}
+
+	// Four 18-byte descriptors follow the standard timings
+	for offset := 54; offset+descriptorSize <= 126; offset += descriptorSize {
+		e.parseDescriptor(base[offset : offset+descriptorSize])
+	}
+
+	// The first detailed timing is the preferred (native) mode. EDID 1.3 flags this
+	// in the feature support byte, EDID 1.4 always sets it.
+	if len(e.DetailedTimings) > 0 && (base[24]&0x02 != 0 || e.Revision >= 4) {
+		preferred := e.DetailedTimings[0]
+		e.PreferredTiming = &preferred
+	}
+
+	extensions := int(base[126])
+	for i := 1; i <= extensions && (i+1)*blockSize <= len(data); i++ {
+		block := data[i*blockSize : (i+1)*blockSize]
+		if block[0] != tagCEAExtension || !validChecksum(block) {
+			continue
+		}
+		e.parseCEAExtension(block)
+	}
+
+	return e, nil
+}
+
+// parseDescriptor decodes a detailed timing or display descriptor
+func (e *EDID) parseDescriptor(d []byte) {
+	if d[0] != 0 || d[1] != 0 {
+		e.DetailedTimings = append(e.DetailedTimings, decodeDetailedTiming(d))
+		return
+	}
+
+	switch d[3] {
+	case tagMonitorName:
+		e.MonitorName = decodeDescriptorText(d[5:])
+	case tagSerialNumber:
+		e.SerialString = decodeDescriptorText(d[5:])
+	}
+}
+
+// parseCEAExtension collects the detailed timings of a CEA-861 extension block
+func (e *EDID) parseCEAExtension(block []byte) {
+	start := int(block[2])
+	if start < 4 {
+		return // No detailed timings in this block
+	}
+
+	for offset := start; offset+descriptorSize <= blockSize-1; offset += descriptorSize {
+		d := block[offset : offset+descriptorSize]
+		if d[0] == 0 && d[1] == 0 {
+			break // Padding follows the last timing
+		}
+		e.DetailedTimings = append(e.DetailedTimings, decodeDetailedTiming(d))
+	}
+}
+
+// decodeDetailedTiming decodes an 18-byte detailed timing descriptor
+func decodeDetailedTiming(d []byte) DetailedTiming {
+	return DetailedTiming{
+		PixelClock: uint32(binary.LittleEndian.Uint16(d[0:2])) * 10,
+		HActive:    uint16(d[2]) | uint16(d[4]&0xF0)<<4,
+		HBlank:     uint16(d[3]) | uint16(d[4]&0x0F)<<8,
+		VActive:    uint16(d[5]) | uint16(d[7]&0xF0)<<4,
+		VBlank:     uint16(d[6]) | uint16(d[7]&0x0F)<<8,
+		WidthMM:    uint16(d[12]) | uint16(d[14]&0xF0)<<4,
+		HeightMM:   uint16(d[13]) | uint16(d[14]&0x0F)<<8,
+		Interlaced: d[17]&0x80 != 0,
+	}
+}
+
+// decodeManufacturerID decodes the three 5-bit letters of the PnP manufacturer ID
+func decodeManufacturerID(v uint16) string {
+	letters := []byte{
+		byte(v>>10&0x1F) + 'A' - 1,
+		byte(v>>5&0x1F) + 'A' - 1,
+		byte(v&0x1F) + 'A' - 1,
+	}
+	return string(letters)
+}
+
+// decodeDescriptorText decodes descriptor text, which ends with a line feed and is padded with spaces
+func decodeDescriptorText(b []byte) string {
+	text := string(b)
+	if idx := strings.IndexByte(text, '\n'); idx != -1 {
+		text = text[:idx]
+	}
+	return strings.TrimSpace(text)
+}
+
+// validChecksum reports whether the bytes of a block sum to zero modulo 256
+func validChecksum(block []byte) bool {
+	var sum byte
+	for _, b := range block {
+		sum += b
+	}
+	return sum == 0
+}
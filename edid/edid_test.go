@@ -0,0 +1,152 @@
+package edid
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readBlob reads an EDID blob from testdata
+func readBlob(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file        string
+		hardwareID  string
+		name        string
+		serial      string
+		year        int
+		native      string
+		refreshRate uint32
+		timings     int
+	}{
+		// EDID 1.3 with a serial number descriptor and a CEA-861 extension
+		{"dell-u2719d.bin", "DEL40F1", "DELL U2719D", "7CMYR13", 2019, "2560x1440", 60, 2},
+		// EDID 1.4 with only the numeric serial number
+		{"lg-27gl850.bin", "GSM5B7F", "LG ULTRAGEAR", "127154", 2020, "2560x1440", 144, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			e, err := Parse(readBlob(t, tt.file))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if got := e.HardwareID(); got != tt.hardwareID {
+				t.Errorf("HardwareID() = %q, want %q", got, tt.hardwareID)
+			}
+			if e.MonitorName != tt.name {
+				t.Errorf("MonitorName = %q, want %q", e.MonitorName, tt.name)
+			}
+			if got := e.Serial(); got != tt.serial {
+				t.Errorf("Serial() = %q, want %q", got, tt.serial)
+			}
+			if e.Year != tt.year {
+				t.Errorf("Year = %d, want %d", e.Year, tt.year)
+			}
+			if len(e.DetailedTimings) != tt.timings {
+				t.Errorf("got %d detailed timings, want %d", len(e.DetailedTimings), tt.timings)
+			}
+
+			if e.PreferredTiming == nil {
+				t.Fatal("no preferred timing")
+			}
+			native := e.PreferredTiming
+			if got := formatSize(native); got != tt.native {
+				t.Errorf("preferred timing is %s, want %s", got, tt.native)
+			}
+			if got := native.RefreshRate(); got != tt.refreshRate {
+				t.Errorf("RefreshRate() = %d, want %d", got, tt.refreshRate)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	dell := readBlob(t, "dell-u2719d.bin")
+
+	badChecksum := append([]byte{}, dell...)
+	badChecksum[20] ^= 0x01
+
+	badHeader := append([]byte{}, dell...)
+	badHeader[0] = 0x01
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated base block", dell[:100]},
+		{"one byte short", dell[:blockSize-1]},
+		{"base block checksum", badChecksum},
+		{"header", badHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(tt.data)
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Parse() = %v, %v; want an ErrInvalid error", e, err)
+			}
+		})
+	}
+}
+
+func TestParseSkipsBrokenExtensions(t *testing.T) {
+	dell := readBlob(t, "dell-u2719d.bin")
+
+	// A truncated extension block is ignored, the base block still decodes
+	e, err := Parse(dell[:blockSize+64])
+	if err != nil {
+		t.Fatalf("Parse with truncated extension: %v", err)
+	}
+	if len(e.DetailedTimings) != 1 {
+		t.Errorf("got %d detailed timings, want only the base block's", len(e.DetailedTimings))
+	}
+
+	// So is an extension block with a bad checksum
+	badExtension := append([]byte{}, dell...)
+	badExtension[blockSize+10] ^= 0x01
+	e, err = Parse(badExtension)
+	if err != nil {
+		t.Fatalf("Parse with bad extension checksum: %v", err)
+	}
+	if len(e.DetailedTimings) != 1 {
+		t.Errorf("got %d detailed timings, want only the base block's", len(e.DetailedTimings))
+	}
+	if e.MonitorName != "DELL U2719D" {
+		t.Errorf("MonitorName = %q, want the base block's name", e.MonitorName)
+	}
+}
+
+func TestDecodeDescriptorText(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"DELL U2719D\n ", "DELL U2719D"},
+		{"7CMYR13\n     ", "7CMYR13"},
+		{"ABCDEFGHIJKLM", "ABCDEFGHIJKLM"}, // 13 characters leave no room for the line feed
+		{"  padded   \n ", "padded"},
+	}
+
+	for _, tt := range tests {
+		if got := decodeDescriptorText([]byte(tt.data)); got != tt.want {
+			t.Errorf("decodeDescriptorText(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func formatSize(t *DetailedTiming) string {
+	return fmt.Sprintf("%dx%d", t.HActive, t.VActive)
+}
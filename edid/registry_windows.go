@@ -0,0 +1,44 @@
+package edid
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// FromRegistry reads the EDID blob Windows stores for a monitor, identified by
+// its PnP device instance ID (e.g. DISPLAY\DEL40F1\5&2A3B4C5D&0&UID4353)
+func FromRegistry(pnpDeviceID string) ([]byte, error) {
+	keyPath := `SYSTEM\CurrentControlSet\Enum\` + pnpDeviceID + `\Device Parameters`
+	keyPathPtr, err := syscall.UTF16PtrFromString(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var hKey syscall.Handle
+	if err := syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, keyPathPtr, 0, syscall.KEY_QUERY_VALUE, &hKey); err != nil {
+		return nil, fmt.Errorf("failed to open registry key %s: %w", keyPath, err)
+	}
+	defer syscall.RegCloseKey(hKey)
+
+	valueNamePtr, err := syscall.UTF16PtrFromString("EDID")
+	if err != nil {
+		return nil, err
+	}
+
+	// Query the size first, then the data
+	var valueType, dataSize uint32
+	if err := syscall.RegQueryValueEx(hKey, valueNamePtr, nil, &valueType, nil, &dataSize); err != nil {
+		return nil, fmt.Errorf("failed to query EDID value: %w", err)
+	}
+	if valueType != syscall.REG_BINARY || dataSize == 0 {
+		return nil, fmt.Errorf("unexpected EDID value (type %d, %d bytes)", valueType, dataSize)
+	}
+
+	data := make([]byte, dataSize)
+	if err := syscall.RegQueryValueEx(hKey, valueNamePtr, nil, &valueType, (*byte)(unsafe.Pointer(&data[0])), &dataSize); err != nil {
+		return nil, fmt.Errorf("failed to read EDID value: %w", err)
+	}
+
+	return data[:dataSize], nil
+}
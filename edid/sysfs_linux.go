@@ -0,0 +1,41 @@
+package edid
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sysfsDRMDir is where the kernel exposes DRM connectors
+const sysfsDRMDir = "/sys/class/drm"
+
+// FromSysfs reads the EDID blobs of all connected DRM connectors, keyed by
+// connector name (e.g. "card0-DP-1")
+func FromSysfs() (map[string][]byte, error) {
+	return fromDRMDir(sysfsDRMDir)
+}
+
+// fromDRMDir reads the EDID blobs of the connectors listed in a DRM class directory
+func fromDRMDir(dir string) (map[string][]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "edid"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DRM connectors: %w", err)
+	}
+
+	blobs := make(map[string][]byte)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		// Disconnected connectors expose an empty file
+		if len(data) == 0 {
+			continue
+		}
+
+		blobs[filepath.Base(filepath.Dir(path))] = data
+	}
+
+	return blobs, nil
+}
@@ -0,0 +1,32 @@
+package edid
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFromDRMDir(t *testing.T) {
+	// A copy of /sys/class/drm with two monitors connected over DisplayPort and an
+	// empty HDMI port
+	blobs, err := fromDRMDir("testdata/drm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"card0-DP-1": "dell-u2719d.bin",
+		"card0-DP-2": "lg-27gl850.bin",
+	}
+	if len(blobs) != len(want) {
+		t.Errorf("got %d connectors, want %d", len(blobs), len(want))
+	}
+	for connector, file := range want {
+		if !bytes.Equal(blobs[connector], readBlob(t, file)) {
+			t.Errorf("%s: got a different EDID than %s", connector, file)
+			continue
+		}
+		if _, err := Parse(blobs[connector]); err != nil {
+			t.Errorf("%s: %v", connector, err)
+		}
+	}
+}
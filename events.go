@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventProcessStarted     = "process_started"     // An application with a rule started
+	EventProcessStopped     = "process_stopped"     // An application with a rule exited
+	EventResolutionApplied  = "resolution_applied"  // A rule changed a monitor
+	EventResolutionRestored = "resolution_restored" // A monitor got its original mode back
+	EventApplyFailed        = "apply_failed"        // A rule could not be applied
+	EventConfigReloaded     = "config_reloaded"     // The config changed, from the file, the GUI or ctl reload
+	EventMonitorAdded       = "monitor_added"
+	EventMonitorRemoved     = "monitor_removed"
+)
+
+// eventBufferSize is the number of events a subscriber may fall behind before
+// it misses events
+const eventBufferSize = 64
+
+// EventHub passes the events of the engine on to everyone subscribed. Publishing
+// never waits for subscribers, so a slow client can't hold up the engine.
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+// NewEventHub creates a hub without subscribers
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[chan Event]bool)}
+}
+
+// Subscribe returns a channel that receives every event published from now on.
+// Call cancel to unsubscribe, which closes the channel.
+func (h *EventHub) Subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, eventBufferSize)
+
+	h.mu.Lock()
+	h.subscribers[ch] = true
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish stamps an event with the time and the csres process ID and sends it to
+// every subscriber
+func (h *EventHub) Publish(event Event) {
+	event.Time = time.Now()
+	event.PID = os.Getpid()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			debugf("Dropping %s event for a subscriber that fell behind", event.Type)
+		}
+	}
+}
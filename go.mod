@@ -6,12 +6,13 @@ require github.com/fsnotify/fsnotify v1.9.0 // direct
 
 require (
 	fyne.io/fyne/v2 v2.6.2
+	github.com/BurntSushi/toml v1.4.0
 	github.com/StackExchange/wmi v1.2.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	fyne.io/systray v1.11.0 // indirect
-	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
 	github.com/fyne-io/gl-js v0.2.0 // indirect
@@ -41,5 +42,4 @@ require (
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
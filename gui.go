@@ -1,13 +1,18 @@
+//go:build windows
+
 package main
 
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -19,12 +24,42 @@ import (
 	"fyne.io/fyne/v2/layout"
 
 	"fyne.io/fyne/v2/widget"
+
+	"csres/version"
 )
 
+// runGUIMode runs the application in graphical user interface mode
+func runGUIMode(configFile, profile string, dryRun bool) error {
+	// A second launch, e.g. from the startup entry while csres is already open, shows the running GUI
+	server, err := ListenControl(configFile)
+	if errors.Is(err, errAlreadyRunning) {
+		return forwardLaunch(configFile, profile, dryRun, true)
+	}
+	if err != nil {
+		logWarnf("Warning: control API not available, other instances can't be detected: %v", err)
+	}
+
+	// The GUI creates a missing config itself, an outdated one is upgraded first
+	if _, err := os.Stat(configFile); err == nil {
+		if _, err := UpgradeConfigFile(configFile, false); err != nil {
+			logWarnf("Warning: %v", err)
+		}
+	}
+
+	// Create and start GUI
+	gui := NewGUIApp(configFile, profile, dryRun)
+	gui.controlServer = server
+	if err := gui.Run(); err != nil {
+		return fmt.Errorf("GUI error: %w", err)
+	}
+	return nil
+}
+
 // GUIApp represents the GUI application
 type GUIApp struct {
 	app                      fyne.App
 	mainWindow               fyne.Window
+	mu                       sync.Mutex // Guards resMonitor and isRunning: they change on the main thread, control requests and the monitoring goroutine read them with monitorState
 	resMonitor               *ResolutionMonitor
 	displayManager           *DisplayManager
 	configPath               string
@@ -38,12 +73,21 @@ type GUIApp struct {
 	showGUICheck             *widget.Check
 	startWithWindowsCheck    *widget.Check
 	autoStartMonitoringCheck *widget.Check
+	persistResolutionCheck   *widget.Check
+	dryRunCheck              *widget.Check
 	isRunning                bool
 	configWatcher            *ConfigWatcher
+	controlServer            *ControlServer // Optional: control endpoint claimed before the GUI was created
+	dashboard                *http.Server   // Optional: dashboard and REST API, started when the config has http
+	events                   *EventHub      // Events of the resolution monitor, subscribers stay across stopping and starting monitoring
+	trayMenu                 *fyne.Menu
+	profileMenu              *fyne.Menu
+	startProfile             string // Profile given on the command line, used instead of active_profile until one is chosen from the tray; never saved
+	dryRun                   bool   // Log resolution changes instead of making them
 }
 
 // NewGUIApp creates a new GUI application
-func NewGUIApp(configPath string) *GUIApp {
+func NewGUIApp(configPath, startProfile string, dryRun bool) *GUIApp {
 	fyneApp := app.NewWithID("com.csres.monitor")
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -51,11 +95,14 @@ func NewGUIApp(configPath string) *GUIApp {
 	gui := &GUIApp{
 		app:            fyneApp,
 		configPath:     configPath,
+		startProfile:   startProfile,
+		dryRun:         dryRun,
 		ctx:            ctx,
 		cancel:         cancel,
 		appData:        binding.NewStringList(),
 		isRunning:      false,
 		displayManager: NewDisplayManager(),
+		events:         NewEventHub(),
 	}
 
 	return gui
@@ -63,6 +110,8 @@ func NewGUIApp(configPath string) *GUIApp {
 
 // Run starts the GUI application
 func (g *GUIApp) Run() error {
+	log.Printf("Starting CS Resolution Monitor %s", version.Get())
+
 	// Set up system tray
 	if desk, ok := g.app.(desktop.App); ok {
 		g.setupSystemTray(desk)
@@ -94,7 +143,7 @@ func (g *GUIApp) Run() error {
 	// Set up config file watcher
 	watcher, err := NewConfigWatcher(g.configPath)
 	if err != nil {
-		log.Printf("Warning: Failed to create config watcher: %v", err)
+		logWarnf("Warning: Failed to create config watcher: %v", err)
 	} else {
 		g.configWatcher = watcher
 		watcher.Start()
@@ -105,18 +154,37 @@ func (g *GUIApp) Run() error {
 				select {
 				case <-g.ctx.Done():
 					return
-				case <-watcher.ConfigChan():
+				case newConfig := <-watcher.ConfigChan():
+					// Apply the edit to applications that are already running
+					if monitor, _ := g.monitorState(); monitor != nil {
+						warnConfigMonitors(newConfig, monitor.inventory.Monitors())
+						monitor.setConfig(newConfig)
+					}
+
 					// Run on main thread since we're updating UI
 					fyne.Do(func() {
 						g.reloadConfig()
 					})
 				case err := <-watcher.ErrorChan():
-					log.Printf("Config watcher error: %v", err)
+					logWarnf("Config watcher error: %v", err)
 				}
 			}
 		}()
 	}
 
+	// Let csres ctl, other tools and later launches steer the GUI
+	if g.controlServer != nil {
+		g.controlServer.Serve(guiControl{gui: g}, "gui")
+	}
+	if config != nil && config.HTTP != nil {
+		dashboard, err := StartDashboard(config.HTTP, guiControl{gui: g}, "gui")
+		if err != nil {
+			logWarnf("Warning: %v", err)
+		} else {
+			g.dashboard = dashboard
+		}
+	}
+
 	// Run the app (this blocks)
 	g.app.Run()
 
@@ -125,6 +193,11 @@ func (g *GUIApp) Run() error {
 
 // setupSystemTray configures the system tray icon and menu
 func (g *GUIApp) setupSystemTray(desk desktop.App) {
+	// Profile submenu, filled in when the config is loaded
+	g.profileMenu = fyne.NewMenu("Profile")
+	profileItem := fyne.NewMenuItem("Profile", nil)
+	profileItem.ChildMenu = g.profileMenu
+
 	// Create tray menu
 	menu := fyne.NewMenu("CS Resolution Monitor",
 		fyne.NewMenuItem("Show", func() {
@@ -134,17 +207,43 @@ func (g *GUIApp) setupSystemTray(desk desktop.App) {
 		fyne.NewMenuItem("Toggle Monitoring", func() {
 			g.toggleMonitoring()
 		}),
+		profileItem,
 		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("About", func() {
+			g.showAbout()
+		}),
 		fyne.NewMenuItem("Quit", func() {
 			g.quit()
 		}),
 	)
 
 	// Set up system tray
+	g.trayMenu = menu
 	desk.SetSystemTrayMenu(menu)
 	desk.SetSystemTrayIcon(resourceIconPng) // We'll need to create this resource
 }
 
+// showAbout shows the version and build details of csres
+func (g *GUIApp) showAbout() {
+	info := version.Get()
+
+	details := fmt.Sprintf("Version: %s\n", info.Short())
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		details += fmt.Sprintf("Commit: %s%s\n", info.Commit, modified)
+	}
+	if info.Date != "" {
+		details += fmt.Sprintf("Built: %s\n", info.Date)
+	}
+	details += fmt.Sprintf("Go: %s %s\nConfig: %s", info.GoVersion, info.Platform, g.configPath)
+
+	g.showMainWindow()
+	dialog.ShowInformation("About CS Resolution Monitor", details, g.mainWindow)
+}
+
 // createMainWindow creates the main configuration window
 func (g *GUIApp) createMainWindow() {
 	window := g.app.NewWindow("CS Resolution Monitor")
@@ -159,9 +258,17 @@ func (g *GUIApp) createMainWindow() {
 		g.toggleMonitoring()
 	})
 
+	// Dry run keeps the engine running but only logs resolution changes
+	g.dryRunCheck = widget.NewCheck("Dry run", func(checked bool) {
+		g.setDryRun(checked)
+	})
+	g.dryRunCheck.SetChecked(g.dryRun)
+	g.updateStatusLabel()
+
 	statusContainer := container.NewHBox(
 		g.statusLabel,
 		layout.NewSpacer(),
+		g.dryRunCheck,
 		g.startStopBtn,
 	)
 
@@ -227,6 +334,7 @@ func (g *GUIApp) createMainWindow() {
 	g.showGUICheck = widget.NewCheck("Show GUI on launch", nil)
 	g.startWithWindowsCheck = widget.NewCheck("Start with Windows", nil)
 	g.autoStartMonitoringCheck = widget.NewCheck("Auto-start monitoring", nil)
+	g.persistResolutionCheck = widget.NewCheck("Keep resolution changes after exit (persistent)", nil)
 
 	saveSettingsBtn := widget.NewButton("Save Settings", func() {
 		g.saveSettings()
@@ -238,6 +346,7 @@ func (g *GUIApp) createMainWindow() {
 		g.showGUICheck,
 		g.startWithWindowsCheck,
 		g.autoStartMonitoringCheck,
+		g.persistResolutionCheck,
 		saveSettingsBtn,
 	)
 
@@ -278,7 +387,7 @@ func (g *GUIApp) loadConfig() error {
 	}
 
 	// Load configuration
-	config, err := LoadConfig(g.configPath)
+	config, _, err := g.loadSessionConfig()
 	if err != nil {
 		return err
 	}
@@ -286,6 +395,7 @@ func (g *GUIApp) loadConfig() error {
 	// Update GUI with loaded config
 	fyne.Do(func() {
 		g.updateAppList(config)
+		g.updateProfileMenu(config)
 		g.pollEntry.SetText(fmt.Sprintf("%d", config.PollInterval))
 
 		// Update checkbox states if they exist
@@ -298,6 +408,9 @@ func (g *GUIApp) loadConfig() error {
 		if g.autoStartMonitoringCheck != nil {
 			g.autoStartMonitoringCheck.SetChecked(config.AutoStartMonitoring)
 		}
+		if g.persistResolutionCheck != nil {
+			g.persistResolutionCheck.SetChecked(config.PersistResolution)
+		}
 		g.mainWindow.Content().Refresh()
 	})
 
@@ -309,8 +422,12 @@ func (g *GUIApp) updateAppList(config *Config) {
 	// Clear existing items
 	g.appData.Set([]string{})
 
-	// Add applications from config
-	for _, app := range config.Applications {
+	// Add applications of the active profile
+	for _, app := range config.Rules() {
+		if app.Disabled {
+			continue
+		}
+
 		monitor := g.getMonitorDisplayName(app.MonitorName)
 
 		// Store the device name in the UI string (hidden) after a null byte so it won't be visible
@@ -365,7 +482,7 @@ func (g *GUIApp) deleteApplication(appInfo string) {
 				}
 
 				// Load current config
-				config, err := LoadConfig(g.configPath)
+				config, savedProfile, err := g.loadSessionConfig()
 				if err != nil {
 					dialog.ShowError(err, g.mainWindow)
 					return
@@ -373,7 +490,7 @@ func (g *GUIApp) deleteApplication(appInfo string) {
 
 				// Remove the application from config
 				newApps := []AppConfig{}
-				for _, configApp := range config.Applications {
+				for _, configApp := range config.Rules() {
 					// Check if this is the app to delete - use a more robust matching
 					// Normalize monitor names for comparison
 					configMonitor := strings.TrimSpace(configApp.MonitorName)
@@ -403,17 +520,17 @@ func (g *GUIApp) deleteApplication(appInfo string) {
 						newApps = append(newApps, configApp)
 					}
 				}
-				config.Applications = newApps
+				config.SetRules(newApps)
 
-				// Save config
-				if err := SaveConfig(config, g.configPath); err != nil {
+				// Save to the user layer, shared layers are never modified
+				if err := saveSessionConfig(config, savedProfile); err != nil {
 					dialog.ShowError(err, g.mainWindow)
 					return
 				}
 
 				// Update resolution monitor config if it exists
 				if g.resMonitor != nil {
-					g.resMonitor.config = config
+					g.resMonitor.setConfig(config)
 				}
 
 				// Reload GUI
@@ -456,6 +573,13 @@ func (g *GUIApp) showAppDialog(app AppConfig, isEdit bool) {
 
 	// Create monitor dropdown
 	monitorOptions, monitorMap := g.getMonitorOptions()
+
+	// Keep stable monitor identifiers selectable so editing doesn't replace them with a device name
+	if isStableMonitorID(app.MonitorName) {
+		configuredOption := fmt.Sprintf("Configured: %s", app.MonitorName)
+		monitorOptions = append(monitorOptions, configuredOption)
+		monitorMap[configuredOption] = app.MonitorName
+	}
 	monitorSelect := widget.NewSelect(monitorOptions, nil)
 
 	// Create resolution dropdown
@@ -470,6 +594,12 @@ func (g *GUIApp) showAppDialog(app AppConfig, isEdit bool) {
 
 	// Function to update resolution options based on selected monitor
 	updateResolutionOptions := func(monitorName string) {
+		monitorName, err := g.displayManager.ResolveMonitor(monitorName)
+		if err != nil {
+			dialog.ShowError(err, g.mainWindow)
+			return
+		}
+
 		resolutions, err := g.displayManager.GetAvailableResolutions(monitorName)
 		if err != nil {
 			dialog.ShowError(fmt.Errorf("failed to get available resolutions: %v", err), g.mainWindow)
@@ -561,6 +691,8 @@ func (g *GUIApp) showAppDialog(app AppConfig, isEdit bool) {
 	// Set initial monitor selection
 	if app.MonitorName == "" {
 		monitorSelect.SetSelected("Primary Monitor")
+	} else if isStableMonitorID(app.MonitorName) {
+		monitorSelect.SetSelected(fmt.Sprintf("Configured: %s", app.MonitorName))
 	} else {
 		// Convert device name back to display name for selection
 		displayName := g.getMonitorDisplayName(app.MonitorName)
@@ -627,7 +759,7 @@ func (g *GUIApp) saveApplication(process string, resolution, restoreResolution R
 	}
 
 	// Load current config
-	config, err := LoadConfig(g.configPath)
+	config, savedProfile, err := g.loadSessionConfig()
 	if err != nil {
 		dialog.ShowError(err, g.mainWindow)
 		return
@@ -648,7 +780,7 @@ func (g *GUIApp) saveApplication(process string, resolution, restoreResolution R
 
 		// Remove the original entry completely
 		newApps := []AppConfig{}
-		for _, configApp := range config.Applications {
+		for _, configApp := range config.Rules() {
 			// Check if this is the original app to remove - use a more robust matching
 			// Normalize monitor names for comparison
 			configMonitor := strings.TrimSpace(configApp.MonitorName)
@@ -678,21 +810,29 @@ func (g *GUIApp) saveApplication(process string, resolution, restoreResolution R
 				newApps = append(newApps, configApp)
 			}
 		}
-		config.Applications = newApps
+		config.SetRules(newApps)
+	}
+
+	// A disabled rule for the same process is replaced by the new one
+	rules := []AppConfig{}
+	for _, configApp := range config.Rules() {
+		if !configApp.Disabled || !strings.EqualFold(configApp.ProcessName, newApp.ProcessName) {
+			rules = append(rules, configApp)
+		}
 	}
 
 	// Always add the new application (whether it's a new entry or an edit)
-	config.Applications = append(config.Applications, newApp)
+	config.SetRules(append(rules, newApp))
 
-	// Save config
-	if err := SaveConfig(config, g.configPath); err != nil {
+	// Save to the user layer, shared layers are never modified
+	if err := saveSessionConfig(config, savedProfile); err != nil {
 		dialog.ShowError(err, g.mainWindow)
 		return
 	}
 
 	// Update resolution monitor config if it exists
 	if g.resMonitor != nil {
-		g.resMonitor.config = config
+		g.resMonitor.setConfig(config)
 	}
 
 	// Reload GUI
@@ -708,7 +848,7 @@ func (g *GUIApp) saveSettings() {
 	}
 
 	// Load current config
-	config, err := LoadConfig(g.configPath)
+	config, savedProfile, err := g.loadSessionConfig()
 	if err != nil {
 		dialog.ShowError(err, g.mainWindow)
 		return
@@ -719,6 +859,7 @@ func (g *GUIApp) saveSettings() {
 	config.ShowGUIOnLaunch = g.showGUICheck.Checked
 	config.StartWithWindows = g.startWithWindowsCheck.Checked
 	config.AutoStartMonitoring = g.autoStartMonitoringCheck.Checked
+	config.PersistResolution = g.persistResolutionCheck.Checked
 
 	// Handle Windows startup setting
 	if err := g.handleWindowsStartup(config.StartWithWindows); err != nil {
@@ -726,20 +867,108 @@ func (g *GUIApp) saveSettings() {
 		return
 	}
 
-	// Save config
-	if err := SaveConfig(config, g.configPath); err != nil {
+	// Save to the user layer, shared layers are never modified
+	if err := saveSessionConfig(config, savedProfile); err != nil {
 		dialog.ShowError(err, g.mainWindow)
 		return
 	}
 
 	// Update resolution monitor config if it exists
 	if g.resMonitor != nil {
-		g.resMonitor.config = config
+		g.resMonitor.setConfig(config)
 	}
 
 	dialog.ShowInformation("Settings Saved", "Settings have been saved successfully.", g.mainWindow)
 }
 
+// updateProfileMenu lists the configured profiles in the tray menu and marks the active one
+func (g *GUIApp) updateProfileMenu(config *Config) {
+	if g.profileMenu == nil {
+		return
+	}
+
+	defaultItem := fyne.NewMenuItem("Default", func() {
+		g.selectProfileFromTray("")
+	})
+	defaultItem.Checked = config.ActiveProfile == ""
+	items := []*fyne.MenuItem{defaultItem}
+
+	for _, name := range config.ProfileNames() {
+		item := fyne.NewMenuItem(name, func() {
+			g.selectProfileFromTray(name)
+		})
+		item.Checked = strings.EqualFold(name, config.ActiveProfile)
+		items = append(items, item)
+	}
+
+	g.profileMenu.Items = items
+	g.trayMenu.Refresh()
+}
+
+// selectProfileFromTray switches profiles and reports errors in the main window
+func (g *GUIApp) selectProfileFromTray(name string) {
+	if err := g.switchProfile(name); err != nil {
+		dialog.ShowError(err, g.mainWindow)
+	}
+}
+
+// switchProfile saves the named profile as the active one. A running monitor
+// restores every changed monitor and evaluates the rules of the new profile.
+func (g *GUIApp) switchProfile(name string) error {
+	config, err := LoadConfig(g.configPath)
+	if err != nil {
+		return err
+	}
+
+	if err := config.SelectProfile(name); err != nil {
+		return err
+	}
+
+	if err := SaveUserConfig(config); err != nil {
+		return err
+	}
+
+	// The saved profile replaces the one given on the command line
+	g.startProfile = ""
+
+	// Update resolution monitor config if it exists
+	if g.resMonitor != nil {
+		g.resMonitor.clearSwitchedProfile()
+		g.resMonitor.setConfig(config)
+	}
+
+	// Reload GUI
+	g.reloadConfig()
+	return nil
+}
+
+// loadSessionConfig loads the config with the profile given on the command line
+// selected. It also returns active_profile as the config files have it, which is
+// what saveSessionConfig writes back.
+func (g *GUIApp) loadSessionConfig() (*Config, string, error) {
+	config, err := LoadConfig(g.configPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	savedProfile := config.ActiveProfile
+	if g.startProfile != "" {
+		if err := config.SelectProfile(g.startProfile); err != nil {
+			logWarnf("Warning: %v, using active_profile from the config file", err)
+			g.startProfile = ""
+		}
+	}
+	return config, savedProfile, nil
+}
+
+// saveSessionConfig saves a config loaded with loadSessionConfig to the user layer,
+// without the profile given on the command line
+func saveSessionConfig(config *Config, savedProfile string) error {
+	saved := *config
+	saved.ActiveProfile = savedProfile
+	return SaveUserConfig(&saved)
+}
+
 // reloadConfig reloads the configuration and updates the GUI
 func (g *GUIApp) reloadConfig() {
 	if err := g.loadConfig(); err != nil {
@@ -769,56 +998,96 @@ func (g *GUIApp) startMonitoring() {
 			dialog.ShowError(fmt.Errorf("failed to create resolution monitor: %w", err), g.mainWindow)
 			return
 		}
+		monitor.events = g.events
+		monitor.SetDryRun(g.dryRun)
+
+		// The profile given on the command line is used like with csres run, without saving it
+		if g.startProfile != "" {
+			if err := monitor.SwitchProfile(g.startProfile); err != nil {
+				logWarnf("Warning: %v", err)
+			}
+		}
+		g.mu.Lock()
 		g.resMonitor = monitor
+		g.mu.Unlock()
+	}
+	g.resMonitor.SetDryRun(g.dryRun)
+	if err := g.resMonitor.Resume(); err != nil {
+		logErrorf("GUI: Error checking running apps: %v", err)
 	}
 
+	g.mu.Lock()
 	g.isRunning = true
-	g.statusLabel.SetText("Status: Running")
+	g.mu.Unlock()
+	g.updateStatusLabel()
 	if g.startStopBtn != nil {
 		g.startStopBtn.SetText("Stop Monitoring")
 	}
 	log.Println("GUI: Starting monitoring...")
 }
 
+// setDryRun switches dry-run mode on or off, also while monitoring
+func (g *GUIApp) setDryRun(dryRun bool) {
+	if dryRun == g.dryRun {
+		return
+	}
+	g.dryRun = dryRun
+	if dryRun {
+		log.Println("GUI: Dry run enabled, resolution changes are logged but not made")
+	} else {
+		log.Println("GUI: Dry run disabled")
+	}
+
+	if g.resMonitor != nil {
+		g.resMonitor.SetDryRun(dryRun)
+	}
+	g.updateStatusLabel()
+}
+
+// updateStatusLabel shows whether monitoring is running and in dry-run mode
+func (g *GUIApp) updateStatusLabel() {
+	status := "Status: Stopped"
+	if g.isRunning {
+		status = "Status: Running"
+	}
+	if g.dryRun {
+		status += " (dry run)"
+	}
+	g.statusLabel.SetText(status)
+}
+
 // stopMonitoring stops the resolution monitoring
 func (g *GUIApp) stopMonitoring() {
 	if !g.isRunning {
 		return
 	}
 
+	g.mu.Lock()
 	g.isRunning = false
-	g.statusLabel.SetText("Status: Stopped")
+	g.mu.Unlock()
+	g.updateStatusLabel()
 	if g.startStopBtn != nil {
 		g.startStopBtn.SetText("Start Monitoring")
 	}
 
-	// Restore original resolutions
+	// Restore original resolutions, rules aren't applied again until monitoring starts
 	if g.resMonitor != nil {
-		for monitorName := range g.resMonitor.currentAppRes {
-			monitorDesc := "primary monitor"
-			if monitorName != "" {
-				monitorDesc = fmt.Sprintf("monitor %s", monitorName)
-			}
-
-			originalRes, exists := g.resMonitor.originalRes[monitorName]
-			if !exists {
-				log.Printf("Warning: no original resolution stored for %s", monitorDesc)
-				continue
-			}
-
-			log.Printf("GUI: Restoring original resolution on %s...", monitorDesc)
-			if err := g.resMonitor.displayManager.SetResolution(monitorName, *originalRes); err != nil {
-				log.Printf("Error restoring resolution on %s: %v", monitorDesc, err)
-			}
-		}
-		// Clear active apps to reset state
-		g.resMonitor.activeApps = make(map[string]AppConfig)
-		g.resMonitor.currentAppRes = make(map[string]*Resolution)
+		log.Println("GUI: Restoring original resolutions...")
+		g.resMonitor.Pause()
 	}
 
 	log.Println("GUI: Monitoring stopped")
 }
 
+// monitorState returns the resolution monitor, nil until monitoring was started
+// once, and whether monitoring is running. Unlike the fields it can be called
+// from any goroutine.
+func (g *GUIApp) monitorState() (*ResolutionMonitor, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resMonitor, g.isRunning
+}
+
 // runResolutionMonitor runs the resolution monitor in the background
 func (g *GUIApp) runResolutionMonitor() {
 	ticker := time.NewTicker(2 * time.Second) // Default polling interval
@@ -829,15 +1098,15 @@ func (g *GUIApp) runResolutionMonitor() {
 		case <-g.ctx.Done():
 			return
 		case <-ticker.C:
-			if g.isRunning && g.resMonitor != nil {
+			// While stopped, monitors and processes are still tracked, without changing modes
+			if monitor, _ := g.monitorState(); monitor != nil {
 				// Check for running applications
-				if err := g.resMonitor.checkRunningApps(); err != nil {
-					log.Printf("GUI: Error checking running apps: %v", err)
+				if err := monitor.checkRunningApps(); err != nil {
+					logErrorf("GUI: Error checking running apps: %v", err)
 				}
 
 				// Update ticker interval if config changed
-				if g.resMonitor.config.PollInterval > 0 {
-					newInterval := time.Duration(g.resMonitor.config.PollInterval) * time.Second
+				if newInterval := monitor.pollInterval(); newInterval > 0 {
 					if ticker.C != nil { // Recreate ticker if interval changed
 						ticker.Stop()
 						ticker = time.NewTicker(newInterval)
@@ -852,12 +1121,18 @@ func (g *GUIApp) runResolutionMonitor() {
 func (g *GUIApp) quit() {
 	log.Println("GUI: Shutting down...")
 	g.cancel()
+	if g.controlServer != nil {
+		g.controlServer.Close()
+	}
+	if g.dashboard != nil {
+		g.dashboard.Close()
+	}
 	if g.resMonitor != nil {
 		g.resMonitor.shutdown()
 	}
 	if g.configWatcher != nil {
 		if err := g.configWatcher.Close(); err != nil {
-			log.Printf("Error closing config watcher: %v", err)
+			logErrorf("Error closing config watcher: %v", err)
 		}
 	}
 	g.app.Quit()
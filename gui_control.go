@@ -0,0 +1,122 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+)
+
+// guiControl steers the GUI through the control API. Requests go through the same
+// code as the window and the tray menu, so the GUI shows their effect. They arrive
+// on their own goroutines: GUI state is changed on the main thread with
+// fyne.DoAndWait and the resolution monitor is looked up with monitorState.
+type guiControl struct {
+	gui *GUIApp
+}
+
+func (c guiControl) Status() EngineStatus {
+	g := c.gui
+	monitor, running := g.monitorState()
+	if monitor == nil {
+		// Monitoring was never started
+		return EngineStatus{
+			SchemaVersion: OutputSchemaVersion,
+			ConfigFile:    g.configPath,
+			DryRun:        g.dryRun,
+			Paused:        true,
+			Monitors:      []MonitorStatus{},
+			ActiveApps:    []AppStatus{},
+		}
+	}
+
+	status := monitor.Status()
+	status.Paused = !running
+	return status
+}
+
+func (c guiControl) Show() error {
+	fyne.DoAndWait(c.gui.showMainWindow)
+	return nil
+}
+
+func (c guiControl) Pause() error {
+	fyne.DoAndWait(c.gui.stopMonitoring)
+	return nil
+}
+
+func (c guiControl) Resume() error {
+	fyne.DoAndWait(c.gui.startMonitoring)
+	if _, running := c.gui.monitorState(); !running {
+		return fmt.Errorf("failed to start monitoring, see the csres window for details")
+	}
+	return nil
+}
+
+func (c guiControl) ApplyRule(processName string) error {
+	monitor, running := c.gui.monitorState()
+	if !running {
+		return fmt.Errorf("monitoring is stopped")
+	}
+	return monitor.ApplyRule(processName)
+}
+
+func (c guiControl) RestoreAll() error {
+	if monitor, _ := c.gui.monitorState(); monitor != nil {
+		monitor.RestoreAll()
+	}
+	return nil
+}
+
+func (c guiControl) SwitchProfile(name string) error {
+	var err error
+	fyne.DoAndWait(func() {
+		err = c.gui.switchProfile(name)
+	})
+	return err
+}
+
+func (c guiControl) ReloadConfig() error {
+	if monitor, _ := c.gui.monitorState(); monitor != nil {
+		if err := monitor.ReloadConfig(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	fyne.DoAndWait(func() {
+		err = c.gui.loadConfig()
+	})
+	return err
+}
+
+func (c guiControl) Rules() []RuleStatus {
+	if monitor, _ := c.gui.monitorState(); monitor != nil {
+		return monitor.Rules()
+	}
+
+	// Monitoring was never started, nothing is running
+	var config *Config
+	var err error
+	fyne.DoAndWait(func() {
+		config, _, err = c.gui.loadSessionConfig()
+	})
+	if err != nil {
+		logErrorf("Error loading config: %v", err)
+		return []RuleStatus{}
+	}
+	return newRuleStatuses(config, nil)
+}
+
+func (c guiControl) History() []HistoryEntry {
+	monitor, _ := c.gui.monitorState()
+	if monitor == nil {
+		return []HistoryEntry{}
+	}
+	return monitor.History()
+}
+
+func (c guiControl) Events() *EventHub {
+	return c.gui.events
+}
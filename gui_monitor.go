@@ -1,8 +1,9 @@
+//go:build windows
+
 package main
 
 import (
 	"fmt"
-	"log"
 )
 
 // getMonitorOptions returns a list of monitor options for the dropdown and a map to convert display names to device names
@@ -18,14 +19,14 @@ func (g *GUIApp) getMonitorOptions() ([]string, map[string]string) {
 	// Get available monitors
 	monitors, err := displayManager.GetAvailableMonitors()
 	if err != nil {
-		log.Printf("Warning: failed to get monitor list for dropdown: %v", err)
+		logWarnf("Warning: failed to get monitor list for dropdown: %v", err)
 		return options, monitorMap
 	}
 
 	// Debug: Print all available monitors
-	log.Println("Available monitors:")
+	debugf("Available monitors:")
 	for i, m := range monitors {
-		log.Printf("[%d] DeviceName=%s DeviceString=%s IsPrimary=%t", i, m.DeviceName, m.DeviceString, m.IsPrimary)
+		debugf("[%d] DeviceName=%s DeviceString=%s IsPrimary=%t", i, m.DeviceName, m.DeviceString, m.IsPrimary)
 	}
 
 	// Add each monitor to the options
@@ -70,6 +71,15 @@ func (g *GUIApp) getMonitorDisplayName(deviceName string) string {
 		return deviceName // Fallback to device name
 	}
 
+	// Resolve stable identifiers to the monitor they currently refer to
+	if isStableMonitorID(deviceName) {
+		resolved, err := resolveMonitorName(deviceName, monitors)
+		if err != nil {
+			return fmt.Sprintf("%s (not connected)", deviceName)
+		}
+		deviceName = resolved
+	}
+
 	// Find the monitor with matching device name
 	for i, monitor := range monitors {
 		if monitor.DeviceName == deviceName {
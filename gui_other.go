@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// runGUIMode reports that the GUI is not available, it is only built for Windows
+func runGUIMode(configFile, profile string, dryRun bool) error {
+	return errors.New("the GUI is only available on Windows, use csres run to monitor applications in the foreground")
+}
+
+// startupCommand reports that there is no startup entry, csres only registers one
+// on Windows
+func startupCommand() (string, bool) {
+	return "", false
+}
@@ -1,3 +1,5 @@
+//go:build windows
+
 package main
 
 import (
@@ -15,10 +17,15 @@ const (
 	REG_SZ            = 1
 )
 
+const (
+	startupKeyPath   = "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Run"
+	startupValueName = "CSResolutionMonitor"
+)
+
 // handleWindowsStartup manages the Windows startup registry entry
 func (g *GUIApp) handleWindowsStartup(enable bool) error {
-	keyPath := "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Run"
-	valueName := "CSResolutionMonitor"
+	keyPath := startupKeyPath
+	valueName := startupValueName
 
 	if enable {
 		// Add to startup
@@ -33,7 +40,9 @@ func (g *GUIApp) handleWindowsStartup(enable bool) error {
 			return fmt.Errorf("failed to get absolute path: %w", err)
 		}
 
-		return g.setRegistryValue(keyPath, valueName, absPath)
+		// Pass the config path so the same file is used whatever the working directory is
+		command := fmt.Sprintf(`"%s" "%s"`, absPath, g.configPath)
+		return g.setRegistryValue(keyPath, valueName, command)
 	} else {
 		// Remove from startup
 		return g.deleteRegistryValue(keyPath, valueName)
@@ -57,7 +66,7 @@ func (g *GUIApp) setRegistryValue(keyPath, valueName, value string) error {
 		return err
 	}
 
-	valuePtr, err := syscall.UTF16PtrFromString(value)
+	valueUTF16, err := syscall.UTF16FromString(value)
 	if err != nil {
 		return err
 	}
@@ -76,16 +85,13 @@ func (g *GUIApp) setRegistryValue(keyPath, valueName, value string) error {
 	}
 	defer regCloseKey.Call(uintptr(hKey))
 
-	valueBytes := (*[256]byte)(unsafe.Pointer(valuePtr))
-	valueLen := len(syscall.UTF16ToString((*[256]uint16)(unsafe.Pointer(valuePtr))[:]))*2 + 2
-
 	ret, _, _ = regSetValueEx.Call(
 		uintptr(hKey),
 		uintptr(unsafe.Pointer(valueNamePtr)),
 		0,
 		uintptr(REG_SZ),
-		uintptr(unsafe.Pointer(&valueBytes[0])),
-		uintptr(valueLen),
+		uintptr(unsafe.Pointer(&valueUTF16[0])),
+		uintptr(len(valueUTF16)*2), // Size in bytes, including the terminating null
 	)
 
 	if ret != 0 {
@@ -138,22 +144,26 @@ func (g *GUIApp) deleteRegistryValue(keyPath, valueName string) error {
 
 // isInWindowsStartup checks if the application is currently set to start with Windows
 func (g *GUIApp) isInWindowsStartup() bool {
+	_, registered := startupCommand()
+	return registered
+}
+
+// startupCommand returns the command line of the Windows startup registry entry,
+// and whether there is one
+func startupCommand() (string, bool) {
 	advapi32 := syscall.NewLazyDLL("advapi32.dll")
 	regOpenKeyEx := advapi32.NewProc("RegOpenKeyExW")
 	regQueryValueEx := advapi32.NewProc("RegQueryValueExW")
 	regCloseKey := advapi32.NewProc("RegCloseKey")
 
-	keyPath := "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Run"
-	valueName := "CSResolutionMonitor"
-
-	keyPathPtr, err := syscall.UTF16PtrFromString(keyPath)
+	keyPathPtr, err := syscall.UTF16PtrFromString(startupKeyPath)
 	if err != nil {
-		return false
+		return "", false
 	}
 
-	valueNamePtr, err := syscall.UTF16PtrFromString(valueName)
+	valueNamePtr, err := syscall.UTF16PtrFromString(startupValueName)
 	if err != nil {
-		return false
+		return "", false
 	}
 
 	var hKey syscall.Handle
@@ -166,13 +176,14 @@ func (g *GUIApp) isInWindowsStartup() bool {
 	)
 
 	if ret != 0 {
-		return false
+		return "", false
 	}
 	defer regCloseKey.Call(uintptr(hKey))
 
 	var valueType uint32
 	var dataSize uint32
 
+	// Query the size first, then read the value
 	ret, _, _ = regQueryValueEx.Call(
 		uintptr(hKey),
 		uintptr(unsafe.Pointer(valueNamePtr)),
@@ -181,6 +192,25 @@ func (g *GUIApp) isInWindowsStartup() bool {
 		0,
 		uintptr(unsafe.Pointer(&dataSize)),
 	)
+	if ret != 0 {
+		return "", false
+	}
+	if dataSize < 2 {
+		return "", true
+	}
+
+	data := make([]uint16, dataSize/2)
+	ret, _, _ = regQueryValueEx.Call(
+		uintptr(hKey),
+		uintptr(unsafe.Pointer(valueNamePtr)),
+		0,
+		uintptr(unsafe.Pointer(&valueType)),
+		uintptr(unsafe.Pointer(&data[0])),
+		uintptr(unsafe.Pointer(&dataSize)),
+	)
+	if ret != 0 {
+		return "", true
+	}
 
-	return ret == 0
+	return syscall.UTF16ToString(data), true
 }
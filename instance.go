@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// forwardLaunch passes what a second launch was asked to do to the instance that
+// already runs with the same config, instead of starting another one that would
+// fight it over the monitors. A GUI launch shows the running window, a run launch
+// reloads the config, and --profile switches the running instance's profile.
+func forwardLaunch(configFile, profile string, dryRun, showWindow bool) error {
+	status, err := callControl(configFile, "status", nil)
+	if err != nil {
+		return fmt.Errorf("csres is already running with %s but does not respond: %w", configFile, err)
+	}
+	log.Printf("csres is already running with this config (%s, PID %d), passing the request on", status.Mode, status.PID)
+
+	if dryRun && !status.DryRun {
+		logWarnf("Warning: --dry-run is ignored, the running instance keeps making resolution changes")
+	}
+
+	if profile != "" {
+		if _, err := callControl(configFile, "switch_profile", switchProfileParams{Profile: profile}); err != nil {
+			return fmt.Errorf("failed to switch the running instance's profile: %w", err)
+		}
+		log.Printf("Switched the running instance to %s", describeProfile(profile))
+	}
+
+	if !showWindow {
+		if _, err := callControl(configFile, "reload_config", nil); err != nil {
+			return fmt.Errorf("failed to reload the running instance's config: %w", err)
+		}
+		log.Printf("Reloaded the running instance's config")
+		return nil
+	}
+
+	if status.Mode != "gui" {
+		return fmt.Errorf("csres run is already running with this config (PID %d) and has no window, stop it first or use csres ctl", status.PID)
+	}
+	if _, err := callControl(configFile, "show", nil); err != nil {
+		return fmt.Errorf("failed to show the running window: %w", err)
+	}
+	return nil
+}
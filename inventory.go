@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MonitorInventory tracks the connected monitors and detects topology changes
+// (monitors plugged in, removed or swapped on the same output)
+type MonitorInventory struct {
+	displayManager *DisplayManager
+	mu             sync.Mutex             // Guards the fields below, control requests refresh from their own goroutines
+	monitors       map[string]MonitorInfo // map of device name to monitor
+	signature      string                 // cheap fingerprint of the last seen topology
+}
+
+// NewMonitorInventory creates a new MonitorInventory instance
+func NewMonitorInventory(displayManager *DisplayManager) *MonitorInventory {
+	return &MonitorInventory{
+		displayManager: displayManager,
+		monitors:       make(map[string]MonitorInfo),
+	}
+}
+
+// Refresh re-enumerates the monitors and returns the ones that appeared or
+// disappeared since the last call. The full enumeration (WMI, EDID) only runs
+// when the display topology actually changed.
+func (inv *MonitorInventory) Refresh() (added, removed []MonitorInfo, err error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	displays, err := inv.displayManager.enumerateDisplays()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signature := topologySignature(displays)
+	if signature == inv.signature {
+		return nil, nil, nil
+	}
+
+	monitors, err := inv.displayManager.GetAvailableMonitors()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := make(map[string]MonitorInfo, len(monitors))
+	for _, monitor := range monitors {
+		current[monitor.DeviceName] = monitor
+	}
+
+	// A different monitor on the same output counts as a removal plus an addition
+	for deviceName, previous := range inv.monitors {
+		if monitor, exists := current[deviceName]; !exists || monitor.MonitorID != previous.MonitorID {
+			removed = append(removed, previous)
+		}
+	}
+	for deviceName, monitor := range current {
+		if previous, exists := inv.monitors[deviceName]; !exists || monitor.MonitorID != previous.MonitorID {
+			added = append(added, monitor)
+		}
+	}
+
+	inv.monitors = current
+	inv.signature = signature
+
+	sortMonitors(added)
+	sortMonitors(removed)
+	return added, removed, nil
+}
+
+// Monitors returns the monitors seen by the last refresh, ordered by device name
+func (inv *MonitorInventory) Monitors() []MonitorInfo {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	monitors := make([]MonitorInfo, 0, len(inv.monitors))
+	for _, monitor := range inv.monitors {
+		monitors = append(monitors, monitor)
+	}
+	sortMonitors(monitors)
+	return monitors
+}
+
+// Resolve converts a configured monitor name to the current device name using
+// the monitors seen by the last refresh
+func (inv *MonitorInventory) Resolve(monitorName string) (string, error) {
+	if !isStableMonitorID(monitorName) {
+		return monitorName, nil
+	}
+	return resolveMonitorName(monitorName, inv.Monitors())
+}
+
+// topologySignature fingerprints which monitor is attached to which output and which one is primary
+func topologySignature(displays []MonitorInfo) string {
+	entries := make([]string, 0, len(displays))
+	for _, display := range displays {
+		entry := display.DeviceName + "=" + display.MonitorID
+		if display.IsPrimary {
+			entry += "*"
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ";")
+}
+
+// sortMonitors orders monitors by device name
+func sortMonitors(monitors []MonitorInfo) {
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].DeviceName < monitors[j].DeviceName
+	})
+}
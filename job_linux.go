@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// procDir is where the kernel lists the running processes
+const procDir = "/proc"
+
+// ProcessTree is a program started by exec in a process group of its own. The
+// processes it starts inherit the group and stay in it after the program exits, so
+// a launcher and the game it started are waited for together. Processes that leave
+// the group on purpose, like daemons starting a new session, are not.
+type ProcessTree struct {
+	pgid    int
+	signals chan os.Signal
+}
+
+// startProcessTree starts a command in a new process group. Being outside the
+// terminal's group, the program doesn't get Ctrl+C itself: csres passes it and
+// requests to stop on to the group and keeps running to restore the mode.
+func startProcessTree(cmd *exec.Cmd) (*ProcessTree, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	tree := &ProcessTree{signals: make(chan os.Signal, 1)}
+	signal.Notify(tree.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if err := cmd.Start(); err != nil {
+		signal.Stop(tree.signals)
+		return nil, err
+	}
+	tree.pgid = cmd.Process.Pid
+
+	go func() {
+		for sig := range tree.signals {
+			syscall.Kill(-tree.pgid, sig.(syscall.Signal))
+		}
+	}()
+	return tree, nil
+}
+
+// Remaining returns the number of processes in the group that are still running
+func (t *ProcessTree) Remaining() (int, error) {
+	return countGroupProcesses(procDir, t.pgid)
+}
+
+// Wait polls the group until none of its processes are running
+func (t *ProcessTree) Wait(interval time.Duration) error {
+	for {
+		remaining, err := t.Remaining()
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Close stops passing signals on to the group. Processes still in it keep running.
+func (t *ProcessTree) Close() error {
+	signal.Stop(t.signals)
+	close(t.signals)
+	return nil
+}
+
+// countGroupProcesses counts the processes of a process group listed in a proc
+// directory. Zombies have exited and are not counted, they only wait for their
+// parent to collect the exit status.
+func countGroupProcesses(dir string, pgid int) (int, error) {
+	statFiles, err := filepath.Glob(filepath.Join(dir, "[0-9]*", "stat"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	count := 0
+	for _, statFile := range statFiles {
+		data, err := os.ReadFile(statFile)
+		if err != nil {
+			continue // The process exited since the directory was listed
+		}
+		state, group, ok := parseProcStat(data)
+		if ok && group == pgid && state != 'Z' {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// parseProcStat returns the state and process group ID from the contents of
+// /proc/<pid>/stat, e.g. "1234 (cs2) S 1200 1234 ...". The command name is in
+// parentheses and may itself contain spaces and parentheses.
+func parseProcStat(data []byte) (state byte, pgid int, ok bool) {
+	end := bytes.LastIndexByte(data, ')')
+	if end == -1 {
+		return 0, 0, false
+	}
+
+	// state ppid pgrp ...
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 3 || len(fields[0]) != 1 {
+		return 0, 0, false
+	}
+	pgid, err := strconv.Atoi(string(fields[2]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return fields[0][0], pgid, true
+}
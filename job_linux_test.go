@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		stat  string
+		state byte
+		pgid  int
+		ok    bool
+	}{
+		{"1234 (cs2) S 1200 1234 1200 0 -1 4194560 ...", 'S', 1234, true},
+		{"1300 (Web Content (x)) R 1234 1234 1200 0 -1 ...", 'R', 1234, true},
+		{"1301 (wine64-preloader) Z 1 1234 1200 0 -1 ...", 'Z', 1234, true},
+		{"1302 (broken", 0, 0, false},
+		{"1303 (short) S 1", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		state, pgid, ok := parseProcStat([]byte(tt.stat))
+		if state != tt.state || pgid != tt.pgid || ok != tt.ok {
+			t.Errorf("parseProcStat(%q) = %q, %d, %v, want %q, %d, %v", tt.stat, state, pgid, ok, tt.state, tt.pgid, tt.ok)
+		}
+	}
+}
+
+func TestProcessTreeWaitsForChildren(t *testing.T) {
+	// Like a launcher, the shell exits right away and leaves the game running
+	cmd := exec.Command("sh", "-c", "sleep 0.5 & exit 3")
+	tree, err := startProcessTree(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("Wait() = %v, want exit code 3", err)
+	}
+	if remaining, err := tree.Remaining(); err != nil || remaining != 1 {
+		t.Fatalf("Remaining() = %d, %v after the shell exited, want the sleep still running", remaining, err)
+	}
+
+	start := time.Now()
+	if err := tree.Wait(10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if remaining, _ := tree.Remaining(); remaining != 0 {
+		t.Errorf("Remaining() = %d after Wait, want 0", remaining)
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Errorf("Wait returned after %v, before the child process exited", waited)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	JobObjectBasicAccountingInformation = 1
+)
+
+// JOBOBJECT_BASIC_ACCOUNTING_INFORMATION represents the Win32 structure of the same name
+type JOBOBJECT_BASIC_ACCOUNTING_INFORMATION struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
+// ProcessJob groups processes in a Windows job object. Processes started by a
+// process in the job are added to it automatically, so it can be used to wait for
+// a whole process tree, e.g. a game launcher and the game it starts.
+type ProcessJob struct {
+	handle                        syscall.Handle
+	procAssignProcessToJobObject  *syscall.LazyProc
+	procQueryInformationJobObject *syscall.LazyProc
+}
+
+// NewProcessJob creates an anonymous job object
+func NewProcessJob() (*ProcessJob, error) {
+	kernel32dll := syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW := kernel32dll.NewProc("CreateJobObjectW")
+
+	handle, _, err := procCreateJobObjectW.Call(0, 0)
+	if handle == 0 {
+		return nil, fmt.Errorf("failed to create job object: %w", err)
+	}
+
+	return &ProcessJob{
+		handle:                        syscall.Handle(handle),
+		procAssignProcessToJobObject:  kernel32dll.NewProc("AssignProcessToJobObject"),
+		procQueryInformationJobObject: kernel32dll.NewProc("QueryInformationJobObject"),
+	}, nil
+}
+
+// AddCurrentProcess adds csres itself to the job. Everything it starts afterwards
+// is in the job from its first instruction, which avoids racing a child that
+// starts processes of its own before it could be assigned.
+func (j *ProcessJob) AddCurrentProcess() error {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return fmt.Errorf("failed to get current process: %w", err)
+	}
+
+	ret, _, err := j.procAssignProcessToJobObject.Call(uintptr(j.handle), uintptr(process))
+	if ret == 0 {
+		return fmt.Errorf("failed to add process to job object: %w", err)
+	}
+	return nil
+}
+
+// ActiveProcesses returns the number of processes in the job that are still running
+func (j *ProcessJob) ActiveProcesses() (uint32, error) {
+	var info JOBOBJECT_BASIC_ACCOUNTING_INFORMATION
+	ret, _, err := j.procQueryInformationJobObject.Call(
+		uintptr(j.handle),
+		uintptr(JobObjectBasicAccountingInformation),
+		uintptr(unsafe.Pointer(&info)),
+		unsafe.Sizeof(info),
+		0,
+	)
+	if ret == 0 {
+		return 0, fmt.Errorf("failed to query job object: %w", err)
+	}
+	return info.ActiveProcesses, nil
+}
+
+// WaitUntil polls the job until at most the given number of processes are still
+// running in it
+func (j *ProcessJob) WaitUntil(remaining uint32, interval time.Duration) error {
+	for {
+		active, err := j.ActiveProcesses()
+		if err != nil {
+			return err
+		}
+		if active <= remaining {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Close closes the job object. Processes still in it keep running.
+func (j *ProcessJob) Close() error {
+	return syscall.CloseHandle(j.handle)
+}
+
+// ProcessTree is a program started by exec and everything it starts, grouped in a
+// job object that csres is in as well
+type ProcessTree struct {
+	job *ProcessJob
+}
+
+// startProcessTree starts a command in a new job object. Ctrl+C reaches the
+// program through the console, csres ignores it and keeps running to restore the mode.
+func startProcessTree(cmd *exec.Cmd) (*ProcessTree, error) {
+	job, err := NewProcessJob()
+	if err != nil {
+		return nil, err
+	}
+	if err := job.AddCurrentProcess(); err != nil {
+		job.Close()
+		return nil, err
+	}
+
+	signal.Ignore(os.Interrupt)
+	if err := cmd.Start(); err != nil {
+		job.Close()
+		return nil, err
+	}
+	return &ProcessTree{job: job}, nil
+}
+
+// Remaining returns the number of processes in the tree that are still running,
+// csres itself not counted
+func (t *ProcessTree) Remaining() (int, error) {
+	active, err := t.job.ActiveProcesses()
+	if err != nil {
+		return 0, err
+	}
+	return int(active) - 1, nil
+}
+
+// Wait polls the job until csres is the only process left in it
+func (t *ProcessTree) Wait(interval time.Duration) error {
+	return t.job.WaitUntil(1, interval)
+}
+
+// Close closes the job object
+func (t *ProcessTree) Close() error {
+	return t.job.Close()
+}
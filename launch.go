@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// launchPollInterval is how often exec checks whether the programs it started are still running
+const launchPollInterval = 500 * time.Millisecond
+
+// execCommand starts a program with a mode applied, waits for it and everything
+// it started, then restores the previous mode
+func execCommand() *command {
+	var mode, monitor string
+	return &command{
+		name:    "exec",
+		aliases: []string{"run-with"},
+		args:    "-- <program> [arguments...]",
+		summary: "Run a program with a mode applied and restore it when the program exits",
+		logFile: true,
+		flags: func(fs *flag.FlagSet, opts *commandOptions) {
+			fs.StringVar(&mode, "mode", "", "mode to set while the program runs, e.g. 1280x960@144 (default: the program's rule in the config)")
+			fs.StringVar(&monitor, "monitor", "", "monitor to change (default: the rule's monitor, or the primary monitor)")
+			dryRunFlag(fs, opts)
+		},
+		run: func(opts *commandOptions, args []string) error {
+			if len(args) == 0 {
+				return usageError{"missing program to run"}
+			}
+
+			rule, err := launchRule(opts, args[0], mode, monitor)
+			if err != nil {
+				return err
+			}
+
+			code, err := runWithMode(args, rule, opts.dryRun)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return exitCode(code)
+			}
+			return nil
+		},
+	}
+}
+
+// launchRule returns the mode and monitor to use for a program: the --mode and
+// --monitor flags, or else the rule for the program's executable in the config.
+// It returns nil if there is neither.
+func launchRule(opts *commandOptions, program, mode, monitor string) (*AppConfig, error) {
+	// Steam's %command% passes the full path of the executable
+	processName := filepath.Base(program)
+
+	if mode != "" {
+		res, err := ParseResolution(mode)
+		if err != nil {
+			return nil, usageError{err.Error()}
+		}
+		return &AppConfig{ProcessName: processName, Resolution: res, MonitorName: monitor}, nil
+	}
+
+	configFile, err := opts.resolveConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, app := range config.Rules() {
+		if app.Disabled || !strings.EqualFold(app.ProcessName, processName) {
+			continue
+		}
+		if monitor != "" {
+			app.MonitorName = monitor
+		}
+		return &app, nil
+	}
+
+	logWarnf("Warning: no rule for %s in %s and no --mode given, running it without changing the resolution", processName, configFile)
+	return nil, nil
+}
+
+// runWithMode applies a rule, runs a program until it and every process it started
+// have exited, restores the previous mode and returns the program's exit code
+func runWithMode(args []string, rule *AppConfig, dryRun bool) (int, error) {
+	if rule != nil {
+		restore, err := applyLaunchRule(rule, dryRun)
+		if err != nil {
+			return 0, err
+		}
+		defer restore()
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	tree, err := startProcessTree(cmd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+	defer tree.Close()
+	log.Printf("Started %s (PID %d)", args[0], cmd.Process.Pid)
+
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+		return 0, fmt.Errorf("failed to wait for %s: %w", args[0], err)
+	}
+	code := cmd.ProcessState.ExitCode()
+	log.Printf("%s exited with code %d", filepath.Base(args[0]), code)
+
+	// Launchers often exit while the game they started keeps running
+	if remaining, err := tree.Remaining(); err == nil && remaining > 0 {
+		log.Printf("Waiting for %d processes started by %s to exit...", remaining, filepath.Base(args[0]))
+	}
+	if err := tree.Wait(launchPollInterval); err != nil {
+		logWarnf("Warning: failed to wait for child processes: %v", err)
+	}
+
+	return code, nil
+}
+
+// applyLaunchRule sets the mode of a rule and returns a function that restores the
+// previous mode
+func applyLaunchRule(rule *AppConfig, dryRun bool) (func(), error) {
+	displayManager := NewDisplayManager()
+	displayManager.SetDryRun(dryRun)
+
+	inventory, err := loadInventory(displayManager)
+	if err != nil {
+		return nil, err
+	}
+	monitorArg := rule.MonitorName
+	if monitorArg == "" {
+		monitorArg = "primary"
+	}
+	monitorName, err := resolveMonitorArgument(inventory, monitorArg)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := displayManager.GetCurrentResolutionForMonitor(monitorName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resolution of %s: %w", monitorName, err)
+	}
+	modes, err := displayManager.GetAvailableResolutions(monitorName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get modes of %s: %w", monitorName, err)
+	}
+	res, err := supportedMode(rule.Resolution, *previous, modes)
+	if err != nil {
+		return nil, fmt.Errorf("%w by %s", err, monitorName)
+	}
+
+	if IsResolutionEqual(res, *previous) {
+		log.Printf("%s is already at %s", monitorName, FormatResolution(res))
+		return func() {}, nil
+	}
+
+	if dryRun {
+		log.Printf("Dry run: would set %s to %s for %s", monitorName, FormatResolution(res), rule.ProcessName)
+	} else {
+		log.Printf("Changing resolution to %s on %s for %s", FormatResolution(res), monitorName, rule.ProcessName)
+	}
+	if err := displayManager.SetResolution(monitorName, res); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if dryRun {
+			log.Printf("Dry run: would set %s to %s to restore it after %s", monitorName, FormatResolution(*previous), rule.ProcessName)
+		} else {
+			log.Printf("Restoring original resolution: %s on %s", FormatResolution(*previous), monitorName)
+		}
+		if err := displayManager.SetResolution(monitorName, *previous); err != nil {
+			logErrorf("Error restoring resolution on %s: %v", monitorName, err)
+		}
+	}, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel selects which log messages are written
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// logLevelNames maps the values accepted by --log-level to levels
+var logLevelNames = map[string]LogLevel{
+	"debug":   LogDebug,
+	"info":    LogInfo,
+	"warn":    LogWarn,
+	"warning": LogWarn,
+	"error":   LogError,
+}
+
+// currentLogLevel is the level set with --log-level
+var currentLogLevel = LogInfo
+
+// logTimeFormat matches the timestamp of the standard logger
+const logTimeFormat = "2006/01/02 15:04:05 "
+
+const (
+	// logFileName is the log file written to the user config directory by the
+	// commands that keep running, so problems can be looked at after the fact
+	logFileName = "csres.log"
+
+	// maxLogFileSize is the size above which the log file is moved to csres.log.1
+	// when csres starts
+	maxLogFileSize = 1 << 20
+)
+
+// logOutput is the filter installed by SetupLogging
+var logOutput = &levelWriter{out: os.Stderr}
+
+// SetupLogging sets the log level by name and installs the filter on the
+// standard logger
+func SetupLogging(name string) error {
+	level, exists := logLevelNames[strings.ToLower(name)]
+	if !exists {
+		return fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	currentLogLevel = level
+
+	// The filter writes the timestamp itself so it can look at the message
+	log.SetFlags(0)
+	log.SetOutput(logOutput)
+	return nil
+}
+
+// EnableLogFile writes the log to csres.log in the user config directory as well
+// as standard error. A log file that grew too large is rotated first.
+func EnableLogFile() error {
+	path, err := logFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Size() > maxLogFileSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	logOutput.mu.Lock()
+	logOutput.file = file
+	logOutput.mu.Unlock()
+	return nil
+}
+
+// logFilePath returns the path of the log file
+func logFilePath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config directory: %w", err)
+	}
+	return filepath.Join(dir, logFileName), nil
+}
+
+// recentLogLines returns up to n of the last lines of the log file, including the
+// rotated one
+func recentLogLines(path string, n int) ([]string, error) {
+	var lines []string
+	for _, file := range []string{path + ".1", path} {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log file: %w", err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		lines = append(lines, strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")...)
+	}
+
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return lines, nil
+}
+
+// debugf logs a message that is only written at the debug level
+func debugf(format string, args ...any) {
+	if currentLogLevel <= LogDebug {
+		log.Printf(format, args...)
+	}
+}
+
+// logWarnf logs a warning, which is hidden only with --log-level error
+func logWarnf(format string, args ...any) {
+	logOutput.writeMessage(LogWarn, fmt.Sprintf(format, args...))
+}
+
+// logErrorf logs an error, which is always written
+func logErrorf(format string, args ...any) {
+	logOutput.writeMessage(LogError, fmt.Sprintf(format, args...))
+}
+
+// levelWriter drops log messages below the current level. Messages logged with
+// log.Printf are informational; warnings and errors are logged with logWarnf and
+// logErrorf, which pass their level along.
+type levelWriter struct {
+	mu   sync.Mutex
+	out  io.Writer
+	file *os.File // Optional: log file that receives a copy of every message
+}
+
+// Write receives the messages of the standard logger
+func (w *levelWriter) Write(p []byte) (int, error) {
+	return w.write(LogInfo, p)
+}
+
+// writeMessage writes a message ending in a newline, like the standard logger
+func (w *levelWriter) writeMessage(level LogLevel, message string) {
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	w.write(level, []byte(message))
+}
+
+// write writes a message with a timestamp if its level is shown
+func (w *levelWriter) write(level LogLevel, p []byte) (int, error) {
+	if level < currentLogLevel {
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	timestamp := time.Now().Format(logTimeFormat)
+	if w.file != nil {
+		// The log file is best effort, the message still reaches standard error
+		w.file.WriteString(timestamp)
+		w.file.Write(p)
+	}
+
+	if _, err := io.WriteString(w.out, timestamp); err != nil {
+		return 0, err
+	}
+	return w.out.Write(p)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{"debug", []string{"debug message", "info message", "warning message", "error message"}},
+		{"info", []string{"info message", "warning message", "error message"}},
+		{"warn", []string{"warning message", "error message"}},
+		{"error", []string{"error message"}},
+	}
+
+	defer func(out *levelWriter, level LogLevel) {
+		logOutput, currentLogLevel = out, level
+		log.SetOutput(out)
+	}(logOutput, currentLogLevel)
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			logOutput = &levelWriter{out: &buf}
+			if err := SetupLogging(tt.level); err != nil {
+				t.Fatal(err)
+			}
+
+			debugf("debug message")
+			log.Printf("info message")
+			logWarnf("warning message")
+			logErrorf("error message")
+			// Wording no longer decides the level
+			log.Printf("Error-like info message that failed")
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				message := line[len(logTimeFormat):]
+				if !strings.HasPrefix(message, "Error-like") {
+					got = append(got, message)
+				} else if currentLogLevel > LogInfo {
+					t.Errorf("info message written at level %s", tt.level)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,28 +1,52 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"csres/version"
 )
 
 const (
 	DefaultConfigFile = "config.json"
+
+	// maxHistory is the number of resolution changes the engine remembers
+	maxHistory = 100
 )
 
 // ResolutionMonitor is the main application structure
 type ResolutionMonitor struct {
+	mu             sync.Mutex // Guards the state below, config updates can arrive while apps are being checked
 	config         *Config
 	displayManager *DisplayManager
 	processMonitor *ProcessMonitor
 	configWatcher  *ConfigWatcher
+	inventory      *MonitorInventory
 	originalRes    map[string]*Resolution // map of monitor name to original resolution
 	currentAppRes  map[string]*Resolution // map of monitor name to current app resolution
+	appMonitors    map[string]string      // map of process name to the device name its monitor resolved to
 	activeApps     map[string]AppConfig
+	forcedApps     map[string]bool     // Lower-case process names of rules applied with ApplyRule, treated as running until RestoreAll
+	switchedTo     bool                // Set when SwitchProfile selected a profile, which then overrides active_profile on reloads
+	dryRun         bool                // Log resolution changes instead of making them
+	paused         bool                // Set by Pause, rules are not applied until Resume
+	history        []HistoryEntry      // Most recent resolution changes, oldest first
+	processIDs     map[string][]uint32 // Running applications with a rule and their process IDs, kept across restores for process events
+	events         *EventHub           // Receives what the engine does, the GUI replaces it with its own
+	statusOutput   io.Writer           // Optional: receives a JSON status snapshot whenever the state changes
+	lastStatus     []byte              // Last snapshot written to statusOutput
 }
 
 // NewResolutionMonitor creates a new ResolutionMonitor instance
@@ -35,10 +59,12 @@ func NewResolutionMonitor(configPath string) (*ResolutionMonitor, error) {
 
 	// Initialize components
 	displayManager := NewDisplayManager()
+	displayManager.SetPersistent(config.EffectivePersistResolution())
 	processMonitor := NewProcessMonitor()
 
 	// Get available monitors and store original resolutions
-	monitors, err := displayManager.GetAvailableMonitors()
+	inventory := NewMonitorInventory(displayManager)
+	monitors, _, err := inventory.Refresh()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get available monitors: %w", err)
 	}
@@ -57,13 +83,15 @@ func NewResolutionMonitor(configPath string) (*ResolutionMonitor, error) {
 		if monitor.DeviceName != "" {
 			res, err := displayManager.GetCurrentResolutionForMonitor(monitor.DeviceName)
 			if err != nil {
-				log.Printf("Warning: failed to get resolution for monitor %s: %v", monitor.DeviceName, err)
+				logWarnf("Warning: failed to get resolution for monitor %s: %v", monitor.DeviceName, err)
 				continue
 			}
 			originalRes[monitor.DeviceName] = res
 		}
 	}
 
+	warnConfigMonitors(config, monitors)
+
 	// Initialize config watcher
 	configWatcher, err := NewConfigWatcher(configPath)
 	if err != nil {
@@ -75,9 +103,14 @@ func NewResolutionMonitor(configPath string) (*ResolutionMonitor, error) {
 		displayManager: displayManager,
 		processMonitor: processMonitor,
 		configWatcher:  configWatcher,
+		inventory:      inventory,
 		originalRes:    originalRes,
 		currentAppRes:  make(map[string]*Resolution),
+		appMonitors:    make(map[string]string),
 		activeApps:     make(map[string]AppConfig),
+		forcedApps:     make(map[string]bool),
+		processIDs:     make(map[string][]uint32),
+		events:         NewEventHub(),
 	}
 
 	return rm, nil
@@ -85,12 +118,11 @@ func NewResolutionMonitor(configPath string) (*ResolutionMonitor, error) {
 
 // Start begins the monitoring process
 func (rm *ResolutionMonitor) Start() error {
-	log.Printf("Starting CS Resolution Monitor...")
+	log.Printf("Starting CS Resolution Monitor %s...", version.Get())
 
 	// List available monitors
-	monitors, err := rm.displayManager.GetAvailableMonitors()
-	if err != nil {
-		log.Printf("Warning: failed to get monitor list: %v", err)
+	if monitors := rm.inventory.Monitors(); len(monitors) == 0 {
+		logWarnf("Warning: no monitors detected")
 	} else {
 		log.Printf("Available monitors:")
 		for _, monitor := range monitors {
@@ -103,6 +135,12 @@ func (rm *ResolutionMonitor) Start() error {
 			} else {
 				log.Printf("  %s: %s%s", monitor.DeviceName, monitor.DeviceString, primaryMarker)
 			}
+			if monitor.NativeResolution != nil {
+				log.Printf("    native mode: %dx%d@%dHz", monitor.NativeResolution.Width, monitor.NativeResolution.Height, monitor.NativeResolution.Frequency)
+			}
+			if id := stableMonitorID(monitor); id != "" {
+				log.Printf("    stable id: %s", id)
+			}
 		}
 	}
 
@@ -112,9 +150,11 @@ func (rm *ResolutionMonitor) Start() error {
 
 	// Start config file watcher
 	rm.configWatcher.Start()
+	rm.writeStatus()
 
 	// Create ticker for process monitoring
-	ticker := time.NewTicker(time.Duration(rm.config.PollInterval) * time.Second)
+	interval := rm.pollInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Setup signal handling for graceful shutdown
@@ -124,21 +164,31 @@ func (rm *ResolutionMonitor) Start() error {
 	for {
 		select {
 		case <-ticker.C:
-			log.Println("Checking running apps...")
+			debugf("Checking running apps...")
 			// Check for running applications
 			if err := rm.checkRunningApps(); err != nil {
-				log.Printf("Error checking running apps: %v", err)
+				logErrorf("Error checking running apps: %v", err)
+			}
+			rm.writeStatus()
+
+			// The config may also be reloaded through the control API
+			if newInterval := rm.pollInterval(); newInterval != interval {
+				interval = newInterval
+				ticker.Reset(interval)
 			}
 
 		case newConfig := <-rm.configWatcher.ConfigChan():
+			warnConfigMonitors(newConfig, rm.inventory.Monitors())
+
 			log.Println("Configuration file updated, reloading...")
-			rm.config = newConfig
+			rm.setConfig(newConfig)
 			// Update ticker interval if changed
-			ticker.Stop()
-			ticker = time.NewTicker(time.Duration(rm.config.PollInterval) * time.Second)
+			interval = rm.pollInterval()
+			ticker.Reset(interval)
+			rm.writeStatus()
 
 		case err := <-rm.configWatcher.ErrorChan():
-			log.Printf("Config watcher error: %v", err)
+			logWarnf("Config watcher error: %v", err)
 
 		case <-sigChan:
 			log.Println("Received shutdown signal...")
@@ -147,19 +197,458 @@ func (rm *ResolutionMonitor) Start() error {
 	}
 }
 
+// setConfig replaces the active configuration, applies its display settings and
+// reconciles applications that are already running with their updated rules
+func (rm *ResolutionMonitor) setConfig(config *Config) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	// A profile chosen with SwitchProfile stays active while it exists
+	if rm.switchedTo {
+		if err := config.SelectProfile(rm.config.ActiveProfile); err != nil {
+			logWarnf("Warning: %v, using active_profile from the config file", err)
+			rm.switchedTo = false
+		}
+	}
+
+	profileChanged := !strings.EqualFold(config.ActiveProfile, rm.config.ActiveProfile)
+	rm.config = config
+	rm.displayManager.SetPersistent(config.EffectivePersistResolution())
+	rm.events.Publish(Event{Type: EventConfigReloaded})
+
+	// A different profile replaces every rule, so start over instead of reconciling
+	if profileChanged {
+		log.Printf("Active profile changed to %s", describeProfile(config.ActiveProfile))
+		rm.restoreAllMonitors()
+
+		// While paused the new rules are applied by Resume
+		if rm.paused {
+			return
+		}
+		if err := rm.updateRunningApps(); err != nil {
+			logErrorf("Error checking running apps: %v", err)
+		}
+		return
+	}
+
+	rm.reconcileRunningApps()
+}
+
+// reconcileRunningApps compares the rules of running applications with the current
+// config. Apps whose rule was deleted are handled as if they stopped, apps whose
+// target resolution changed get it applied again, and apps that switched monitors
+// release the old monitor before the new one is changed. Running apps that gained
+// a rule are picked up by the next check.
+func (rm *ResolutionMonitor) reconcileRunningApps() {
+	rules := make(map[string]AppConfig)
+	for _, app := range rm.config.Rules() {
+		if !app.Disabled {
+			rules[strings.ToLower(app.ProcessName)] = app
+		}
+	}
+
+	// Rules that were deleted first, so their monitors are free for the changed ones
+	for processName := range rm.activeApps {
+		if _, exists := rules[strings.ToLower(processName)]; exists {
+			continue
+		}
+
+		log.Printf("Rule for %s was removed from the configuration", processName)
+		oldRule := rm.activeApps[processName]
+		delete(rm.activeApps, processName)
+		if err := rm.handleAppStop(processName, oldRule, rm.activeApps); err != nil {
+			logErrorf("Error handling app stop for %s: %v", processName, err)
+		}
+	}
+
+	activeApps := make(map[string]AppConfig, len(rm.activeApps))
+	for processName, oldRule := range rm.activeApps {
+		newRule := rules[strings.ToLower(processName)]
+
+		// Process names are matched case-insensitively, keep state under the configured name
+		if newRule.ProcessName != processName {
+			if monitorName, exists := rm.appMonitors[processName]; exists {
+				delete(rm.appMonitors, processName)
+				rm.appMonitors[newRule.ProcessName] = monitorName
+			}
+			processName = newRule.ProcessName
+		}
+		activeApps[processName] = newRule
+
+		if oldRule.MonitorName == newRule.MonitorName && IsResolutionEqual(oldRule.Resolution, newRule.Resolution) {
+			continue
+		}
+
+		log.Printf("Rule for %s changed, applying %dx%d@%dHz", processName,
+			newRule.Resolution.Width, newRule.Resolution.Height, newRule.Resolution.Frequency)
+
+		// Restore the previous monitor first if the app moved to a different one
+		if oldMonitor, applied := rm.appMonitors[processName]; applied {
+			newMonitor, err := rm.inventory.Resolve(newRule.MonitorName)
+			if err != nil || newMonitor != oldMonitor {
+				if err := rm.handleAppStop(processName, oldRule, rm.activeApps); err != nil {
+					logErrorf("Error restoring resolution for %s: %v", processName, err)
+				}
+			}
+		}
+
+		if err := rm.handleAppStart(processName, newRule); err != nil {
+			logErrorf("Error applying resolution for %s: %v", processName, err)
+		}
+	}
+	rm.activeApps = activeApps
+}
+
+// SwitchProfile activates another profile. Every monitor an application changed is
+// restored first, then the rules of the new profile are evaluated from scratch,
+// or on Resume while paused. An empty name switches back to the top-level
+// applications list.
+func (rm *ResolutionMonitor) SwitchProfile(name string) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	config := *rm.config
+	if err := config.SelectProfile(name); err != nil {
+		return err
+	}
+
+	log.Printf("Switching to %s...", describeProfile(config.ActiveProfile))
+	rm.restoreAllMonitors()
+	rm.config = &config
+	rm.switchedTo = true
+	rm.displayManager.SetPersistent(config.EffectivePersistResolution())
+
+	// While paused the new rules are applied by Resume
+	if rm.paused {
+		return nil
+	}
+	return rm.updateRunningApps()
+}
+
+// clearSwitchedProfile makes reloads use active_profile from the config again,
+// after the GUI saved a different profile than the one chosen with SwitchProfile
+func (rm *ResolutionMonitor) clearSwitchedProfile() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.switchedTo = false
+}
+
+// describeProfile returns a log description for a profile name
+func describeProfile(name string) string {
+	if name == "" {
+		return "the default rules"
+	}
+	return fmt.Sprintf("profile %s", name)
+}
+
+// pollInterval returns how often running applications are checked with the current config
+func (rm *ResolutionMonitor) pollInterval() time.Duration {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return time.Duration(rm.config.EffectivePollInterval()) * time.Second
+}
+
+// ActiveProfile returns the name of the active profile, empty when the top-level
+// applications list is in use
+func (rm *ResolutionMonitor) ActiveProfile() string {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.config.ActiveProfile
+}
+
+// Status returns a snapshot of the monitors and the running applications with a rule
+func (rm *ResolutionMonitor) Status() EngineStatus {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	status := EngineStatus{
+		SchemaVersion: OutputSchemaVersion,
+		ConfigFile:    rm.config.source,
+		ActiveProfile: rm.config.ActiveProfile,
+		DryRun:        rm.dryRun,
+		Paused:        rm.paused,
+		Monitors:      []MonitorStatus{},
+		ActiveApps:    []AppStatus{},
+	}
+
+	// The primary monitor is tracked as "" when a rule doesn't name a monitor
+	owners := make(map[string][]string)
+	for processName, monitorName := range rm.appMonitors {
+		owners[monitorName] = append(owners[monitorName], processName)
+	}
+
+	for _, monitor := range rm.inventory.Monitors() {
+		monitorStatus := newMonitorStatus(monitor)
+		if res, err := rm.displayManager.GetCurrentResolutionForMonitor(monitor.DeviceName); err == nil {
+			monitorStatus.Current = res
+		}
+		if res, exists := rm.originalRes[monitor.DeviceName]; exists {
+			monitorStatus.Baseline = res
+		}
+		monitorStatus.OwnedBy = append(monitorStatus.OwnedBy, owners[monitor.DeviceName]...)
+		if monitor.IsPrimary {
+			monitorStatus.OwnedBy = append(monitorStatus.OwnedBy, owners[""]...)
+		}
+		sort.Strings(monitorStatus.OwnedBy)
+		status.Monitors = append(status.Monitors, monitorStatus)
+	}
+
+	for processName, appConfig := range rm.activeApps {
+		monitorName, applied := rm.appMonitors[processName]
+		if applied && monitorName == "" {
+			monitorName = rm.primaryDeviceName()
+		}
+		status.ActiveApps = append(status.ActiveApps, AppStatus{
+			ProcessName: processName,
+			MonitorName: appConfig.MonitorName,
+			DeviceName:  monitorName,
+			Resolution:  appConfig.Resolution,
+			Applied:     applied,
+		})
+	}
+	sort.Slice(status.ActiveApps, func(i, j int) bool {
+		return status.ActiveApps[i].ProcessName < status.ActiveApps[j].ProcessName
+	})
+
+	return status
+}
+
+// Rules returns the enabled rules of the active profile and whether their
+// application is running
+func (rm *ResolutionMonitor) Rules() []RuleStatus {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return newRuleStatuses(rm.config, rm.activeApps)
+}
+
+// History returns the most recent resolution changes, oldest first
+func (rm *ResolutionMonitor) History() []HistoryEntry {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return append([]HistoryEntry{}, rm.history...)
+}
+
+// recordHistory remembers a resolution change. The caller must hold rm.mu.
+func (rm *ResolutionMonitor) recordHistory(action, monitorName, processName string, res Resolution) {
+	if monitorName == "" {
+		monitorName = rm.primaryDeviceName()
+	}
+	rm.history = append(rm.history, HistoryEntry{
+		Time:        time.Now(),
+		DeviceName:  monitorName,
+		Action:      action,
+		ProcessName: processName,
+		Resolution:  res,
+		DryRun:      rm.dryRun,
+	})
+	if len(rm.history) > maxHistory {
+		rm.history = rm.history[len(rm.history)-maxHistory:]
+	}
+
+	var eventType string
+	switch action {
+	case "applied":
+		eventType = EventResolutionApplied
+	case "restored":
+		eventType = EventResolutionRestored
+	}
+	rm.events.Publish(Event{
+		Type:        eventType,
+		ProcessName: processName,
+		ProcessIDs:  rm.processIDs[processName],
+		DeviceName:  monitorName,
+		Resolution:  &res,
+		DryRun:      rm.dryRun,
+	})
+}
+
+// primaryDeviceName returns the device name of the primary monitor, or "" if it is unknown
+func (rm *ResolutionMonitor) primaryDeviceName() string {
+	for _, monitor := range rm.inventory.Monitors() {
+		if monitor.IsPrimary {
+			return monitor.DeviceName
+		}
+	}
+	return ""
+}
+
+// SetStatusOutput makes Start write a status snapshot as a line of JSON to w on
+// startup and whenever the monitors or running applications change
+func (rm *ResolutionMonitor) SetStatusOutput(w io.Writer) {
+	rm.statusOutput = w
+}
+
+// writeStatus writes a status snapshot to the status output if it changed
+func (rm *ResolutionMonitor) writeStatus() {
+	if rm.statusOutput == nil {
+		return
+	}
+
+	data, err := json.Marshal(rm.Status())
+	if err != nil {
+		logErrorf("Error encoding status: %v", err)
+		return
+	}
+	if bytes.Equal(data, rm.lastStatus) {
+		return
+	}
+	rm.lastStatus = data
+
+	if _, err := rm.statusOutput.Write(append(data, '\n')); err != nil {
+		logErrorf("Error writing status: %v", err)
+	}
+}
+
 // checkRunningApps monitors for application state changes
 func (rm *ResolutionMonitor) checkRunningApps() error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.paused {
+		return rm.trackWhilePaused()
+	}
+	return rm.updateRunningApps()
+}
+
+// trackWhilePaused keeps the monitor list, the baselines and the set of running
+// applications up to date without changing any mode, so hotplug and process
+// events are still published and Resume starts from the current state. The
+// caller must hold rm.mu.
+func (rm *ResolutionMonitor) trackWhilePaused() error {
+	// Pause restored every monitor and forgot the active applications, so no rule
+	// is applied for a monitor that appears
+	if err := rm.refreshMonitors(); err != nil {
+		logWarnf("Warning: failed to refresh monitor list: %v", err)
+	}
+
+	runningApps, err := rm.processMonitor.MonitorProcesses(rm.config)
+	if err != nil {
+		return err
+	}
+	for _, processName := range rm.publishProcessEvents(runningApps) {
+		delete(rm.processIDs, processName)
+	}
+	return nil
+}
+
+// Pause restores every monitor an application changed and stops applying rules
+// until Resume is called
+func (rm *ResolutionMonitor) Pause() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.paused {
+		return
+	}
+	log.Println("Pausing monitoring, restoring original resolutions...")
+	rm.restoreAllMonitors()
+	rm.paused = true
+}
+
+// Resume applies rules again after Pause, starting with applications that are
+// already running
+func (rm *ResolutionMonitor) Resume() error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if !rm.paused {
+		return nil
+	}
+	log.Println("Resuming monitoring")
+	rm.paused = false
+	return rm.updateRunningApps()
+}
+
+// ApplyRule applies the rule for a process as if it had started, whether it is
+// running or not. The rule stays applied until RestoreAll.
+func (rm *ResolutionMonitor) ApplyRule(processName string) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.paused {
+		return fmt.Errorf("monitoring is paused")
+	}
+
+	for _, app := range rm.config.Rules() {
+		if app.Disabled || !strings.EqualFold(app.ProcessName, processName) {
+			continue
+		}
+		log.Printf("Applying rule for %s on request", app.ProcessName)
+		rm.forcedApps[strings.ToLower(app.ProcessName)] = true
+		return rm.updateRunningApps()
+	}
+	return fmt.Errorf("no enabled rule for %s in %s", processName, describeProfile(rm.config.ActiveProfile))
+}
+
+// RestoreAll restores the original resolution of every monitor an application
+// changed and drops rules applied with ApplyRule. Rules of applications that are
+// still running are applied again on the next check.
+func (rm *ResolutionMonitor) RestoreAll() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	log.Println("Restoring original resolutions on request...")
+	rm.restoreAllMonitors()
+}
+
+// ReloadConfig reads the config file again, as if it had been edited. The running
+// config is kept if the file is invalid; rules for monitors that aren't connected
+// only cause a warning.
+func (rm *ResolutionMonitor) ReloadConfig() error {
+	rm.mu.Lock()
+	configFile := rm.config.source
+	rm.mu.Unlock()
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	warnConfigMonitors(config, rm.inventory.Monitors())
+
+	log.Println("Reloading configuration on request...")
+	rm.setConfig(config)
+	return nil
+}
+
+// warnConfigMonitors logs rules whose monitor is not connected or is ambiguous.
+// Such rules are kept, they apply once the monitor is plugged in.
+func warnConfigMonitors(config *Config, monitors []MonitorInfo) {
+	if err := ValidateConfigMonitors(config, monitors); err != nil {
+		logWarnf("Warning: %v", err)
+	}
+}
+
+// updateRunningApps starts and stops the rules of applications that started or
+// stopped since the last check. The caller must hold rm.mu.
+func (rm *ResolutionMonitor) updateRunningApps() error {
+	if err := rm.refreshMonitors(); err != nil {
+		logWarnf("Warning: failed to refresh monitor list: %v", err)
+	}
+
 	runningApps, err := rm.processMonitor.MonitorProcesses(rm.config)
 	if err != nil {
 		return err
 	}
+	stopped := rm.publishProcessEvents(runningApps)
+
+	// Rules applied with ApplyRule count as running, with their current settings
+	for _, app := range rm.config.Rules() {
+		if _, running := runningApps[app.ProcessName]; !running && !app.Disabled && rm.forcedApps[strings.ToLower(app.ProcessName)] {
+			runningApps[app.ProcessName] = app
+		}
+	}
 
 	// Check for newly started applications
 	for processName, appConfig := range runningApps {
 		if _, exists := rm.activeApps[processName]; !exists {
 			log.Printf("Application started: %s", processName)
 			if err := rm.handleAppStart(processName, appConfig); err != nil {
-				log.Printf("Error handling app start for %s: %v", processName, err)
+				logErrorf("Error handling app start for %s: %v", processName, err)
 			}
 		}
 	}
@@ -168,22 +657,157 @@ func (rm *ResolutionMonitor) checkRunningApps() error {
 	for processName := range rm.activeApps {
 		if _, exists := runningApps[processName]; !exists {
 			log.Printf("Application stopped: %s", processName)
-			if err := rm.handleAppStop(processName, runningApps); err != nil {
-				log.Printf("Error handling app stop for %s: %v", processName, err)
+			if err := rm.handleAppStop(processName, rm.activeApps[processName], runningApps); err != nil {
+				logErrorf("Error handling app stop for %s: %v", processName, err)
 			}
 		}
 	}
 
 	rm.activeApps = runningApps
+
+	// Events about restoring a monitor after an app stopped still carry its process IDs
+	for _, processName := range stopped {
+		delete(rm.processIDs, processName)
+	}
 	return nil
 }
 
+// publishProcessEvents compares the applications with a rule that are running
+// with the last check and publishes which started and stopped. Unlike activeApps,
+// the processes are not forgotten when every monitor is restored. Returns the
+// applications that stopped, the caller forgets their process IDs.
+func (rm *ResolutionMonitor) publishProcessEvents(runningApps map[string]AppConfig) []string {
+	var stopped []string
+	for processName := range runningApps {
+		if _, known := rm.processIDs[processName]; known {
+			continue
+		}
+		pids, err := rm.processMonitor.GetProcessIDs(processName)
+		if err != nil {
+			logWarnf("Warning: failed to get process IDs of %s: %v", processName, err)
+		}
+		rm.processIDs[processName] = pids
+		rm.events.Publish(Event{Type: EventProcessStarted, ProcessName: processName, ProcessIDs: pids})
+	}
+
+	for processName, pids := range rm.processIDs {
+		if _, running := runningApps[processName]; running {
+			continue
+		}
+		stopped = append(stopped, processName)
+		rm.events.Publish(Event{Type: EventProcessStopped, ProcessName: processName, ProcessIDs: pids})
+	}
+	return stopped
+}
+
+// refreshMonitors detects monitors that were plugged in or removed. New monitors get
+// a baseline resolution, removed ones are forgotten, and running applications whose
+// target monitor just appeared get their resolution applied.
+func (rm *ResolutionMonitor) refreshMonitors() error {
+	added, removed, err := rm.inventory.Refresh()
+	if err != nil {
+		return err
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	for _, monitor := range removed {
+		log.Printf("Monitor removed: %s (%s)", monitor.DeviceName, monitor.DeviceString)
+		status := newMonitorStatus(monitor)
+		rm.events.Publish(Event{Type: EventMonitorRemoved, Monitor: &status})
+		delete(rm.originalRes, monitor.DeviceName)
+		delete(rm.currentAppRes, monitor.DeviceName)
+
+		// Forget which apps were using this monitor so their resolution is applied again if it returns
+		for processName, monitorName := range rm.appMonitors {
+			if monitorName == monitor.DeviceName {
+				delete(rm.appMonitors, processName)
+			}
+		}
+	}
+
+	addedMonitors := make(map[string]bool)
+	for _, monitor := range added {
+		log.Printf("Monitor added: %s (%s)", monitor.DeviceName, monitor.DeviceString)
+		addedMonitors[monitor.DeviceName] = true
+		status := newMonitorStatus(monitor)
+		rm.events.Publish(Event{Type: EventMonitorAdded, Monitor: &status})
+
+		// A baseline read while an app has the monitor changed would restore the app's mode
+		if rm.monitorInUse(monitor.DeviceName) {
+			continue
+		}
+
+		res, err := rm.displayManager.GetCurrentResolutionForMonitor(monitor.DeviceName)
+		if err != nil {
+			logWarnf("Warning: failed to get resolution for monitor %s: %v", monitor.DeviceName, err)
+			continue
+		}
+		rm.originalRes[monitor.DeviceName] = res
+	}
+
+	// The primary monitor may have changed, update its baseline unless an app is using it
+	if !rm.monitorInUse("") {
+		if primaryRes, err := rm.displayManager.GetCurrentResolution(); err == nil {
+			rm.originalRes[""] = primaryRes
+		}
+	}
+
+	// Apply rules of running apps whose target monitor just appeared
+	for processName, appConfig := range rm.activeApps {
+		if _, applied := rm.appMonitors[processName]; applied {
+			continue
+		}
+
+		monitorName, err := rm.inventory.Resolve(appConfig.MonitorName)
+		if err != nil || !addedMonitors[monitorName] {
+			continue
+		}
+
+		log.Printf("Target monitor of %s is now available", processName)
+		if err := rm.handleAppStart(processName, appConfig); err != nil {
+			logErrorf("Error applying resolution for %s: %v", processName, err)
+		}
+	}
+
+	return nil
+}
+
+// monitorInUse reports whether an application changed a monitor. Rules may name the
+// primary monitor with the empty name or with its device name, both count.
+func (rm *ResolutionMonitor) monitorInUse(deviceName string) bool {
+	if _, inUse := rm.currentAppRes[deviceName]; inUse {
+		return true
+	}
+
+	primary := rm.primaryDeviceName()
+	if primary == "" {
+		return false
+	}
+	switch deviceName {
+	case "":
+		_, inUse := rm.currentAppRes[primary]
+		return inUse
+	case primary:
+		_, inUse := rm.currentAppRes[""]
+		return inUse
+	}
+	return false
+}
+
 // handleAppStart changes resolution when a monitored application starts
 func (rm *ResolutionMonitor) handleAppStart(processName string, appConfig AppConfig) error {
-	monitorName := appConfig.MonitorName
+	// Resolve stable monitor identifiers to the current device name
+	monitorName, err := rm.inventory.Resolve(appConfig.MonitorName)
+	if err != nil {
+		return rm.applyFailed(processName, appConfig, "", err)
+	}
+
 	currentRes, err := rm.displayManager.GetCurrentResolutionForMonitor(monitorName)
 	if err != nil {
-		return err
+		return rm.applyFailed(processName, appConfig, monitorName, err)
 	}
 
 	// Only change if the target resolution is different from current
@@ -196,32 +820,79 @@ func (rm *ResolutionMonitor) handleAppStart(processName string, appConfig AppCon
 		log.Printf("Changing resolution to %dx%d@%dHz on %s for %s",
 			appConfig.Resolution.Width, appConfig.Resolution.Height, appConfig.Resolution.Frequency, monitorDesc, processName)
 
-		if err := rm.displayManager.SetResolution(monitorName, appConfig.Resolution); err != nil {
-			return err
+		if err := rm.setResolution(monitorName, appConfig.Resolution, "for "+processName); err != nil {
+			return rm.applyFailed(processName, appConfig, monitorName, err)
 		}
+		rm.recordHistory("applied", monitorName, processName, appConfig.Resolution)
 
 		rm.currentAppRes[monitorName] = &appConfig.Resolution
 		log.Printf("Resolution changed successfully on %s", monitorDesc)
 	}
 
+	// Only now the rule counts as applied, a failed app is tried again when its monitor returns
+	rm.appMonitors[processName] = monitorName
 	return nil
 }
 
-// handleAppStop restores original resolution when monitored applications stop
-func (rm *ResolutionMonitor) handleAppStop(processName string, runningApps map[string]AppConfig) error {
-	// Find which monitor this app was using
-	var appMonitorName string
-	for _, app := range rm.config.Applications {
-		if app.ProcessName == processName {
-			appMonitorName = app.MonitorName
-			break
+// applyFailed publishes that the rule of an application could not be applied and
+// returns the error
+func (rm *ResolutionMonitor) applyFailed(processName string, appConfig AppConfig, monitorName string, err error) error {
+	res := appConfig.Resolution
+	rm.events.Publish(Event{
+		Type:        EventApplyFailed,
+		ProcessName: processName,
+		ProcessIDs:  rm.processIDs[processName],
+		DeviceName:  monitorName,
+		Resolution:  &res,
+		Error:       err.Error(),
+	})
+	return err
+}
+
+// setResolution changes the mode of a monitor. In dry-run mode the change is only
+// logged, the display manager then reports the mode as if it had been applied.
+func (rm *ResolutionMonitor) setResolution(monitorName string, res Resolution, reason string) error {
+	if rm.dryRun {
+		monitorDesc := monitorName
+		if monitorName == "" {
+			monitorDesc = "the primary monitor"
 		}
+		log.Printf("Dry run: would set %s to %s %s", monitorDesc, FormatResolution(res), reason)
 	}
+	return rm.displayManager.SetResolution(monitorName, res)
+}
+
+// SetDryRun enables dry-run mode, in which the engine runs normally but resolution
+// changes are logged instead of made. Monitors changed in the previous mode are
+// restored first, running applications get their rules applied again on the next check.
+func (rm *ResolutionMonitor) SetDryRun(dryRun bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if dryRun == rm.dryRun {
+		return
+	}
+	rm.restoreAllMonitors()
+	rm.dryRun = dryRun
+	rm.displayManager.SetDryRun(dryRun)
+}
+
+// handleAppStop restores original resolution when monitored applications stop,
+// or the rule's restore_resolution if it has one
+func (rm *ResolutionMonitor) handleAppStop(processName string, appConfig AppConfig, runningApps map[string]AppConfig) error {
+	// Find which monitor this app was using
+	appMonitorName, exists := rm.appMonitors[processName]
+	if !exists {
+		// The resolution was never applied, or its monitor has been disconnected since
+		log.Printf("No resolution to restore for %s", processName)
+		return nil
+	}
+	delete(rm.appMonitors, processName)
 
 	// Check if any other apps are still using the same monitor
 	monitorStillInUse := false
-	for _, activeApp := range runningApps {
-		if activeApp.MonitorName == appMonitorName {
+	for activeName := range runningApps {
+		if monitor, exists := rm.appMonitors[activeName]; exists && monitor == appMonitorName {
 			monitorStillInUse = true
 			break
 		}
@@ -229,8 +900,13 @@ func (rm *ResolutionMonitor) handleAppStop(processName string, runningApps map[s
 
 	// If no more apps are using this monitor, restore its original resolution
 	if !monitorStillInUse {
-		// Get the original resolution for this monitor
-		originalRes, exists := rm.originalRes[appMonitorName]
+		// Get the original resolution for this monitor, unless the rule names the one to restore
+		restoreRes, exists := rm.originalRes[appMonitorName]
+		restoreDesc := "original resolution"
+		if appConfig.RestoreResolution != nil {
+			restoreRes, exists = appConfig.RestoreResolution, true
+			restoreDesc = "restore_resolution of " + processName
+		}
 		if !exists {
 			return fmt.Errorf("no original resolution stored for monitor %s", appMonitorName)
 		}
@@ -241,23 +917,24 @@ func (rm *ResolutionMonitor) handleAppStop(processName string, runningApps map[s
 		}
 
 		// Only change if current resolution is different from original
-		if !IsResolutionEqual(*currentRes, *originalRes) {
+		if !IsResolutionEqual(*currentRes, *restoreRes) {
 			monitorDesc := "primary monitor"
 			if appMonitorName != "" {
 				monitorDesc = fmt.Sprintf("monitor %s", appMonitorName)
 			}
 
-			log.Printf("Restoring original resolution: %dx%d@%dHz on %s",
-				originalRes.Width, originalRes.Height, originalRes.Frequency, monitorDesc)
+			log.Printf("Restoring %s: %dx%d@%dHz on %s",
+				restoreDesc, restoreRes.Width, restoreRes.Height, restoreRes.Frequency, monitorDesc)
 
-			if err := rm.displayManager.SetResolution(appMonitorName, *originalRes); err != nil {
+			if err := rm.setResolution(appMonitorName, *restoreRes, "to restore it after "+processName); err != nil {
 				return err
 			}
+			rm.recordHistory("restored", appMonitorName, processName, *restoreRes)
 
 			delete(rm.currentAppRes, appMonitorName)
-			log.Printf("Original resolution restored on %s", monitorDesc)
+			log.Printf("Resolution restored on %s", monitorDesc)
 		} else {
-			log.Printf("Resolution on monitor %s is already at the original setting.", appMonitorName)
+			log.Printf("Resolution on monitor %s is already at the %s.", appMonitorName, restoreDesc)
 		}
 	} else {
 		log.Printf("Not restoring resolution for monitor %s because it is still in use.", appMonitorName)
@@ -266,11 +943,11 @@ func (rm *ResolutionMonitor) handleAppStop(processName string, runningApps map[s
 	return nil
 }
 
-// shutdown performs cleanup before exiting
-func (rm *ResolutionMonitor) shutdown() error {
-	log.Println("Shutting down...")
-
-	// Restore original resolution on all monitors that were changed
+// restoreAllMonitors restores the original resolution of every monitor an
+// application changed and forgets the running applications and rules applied with
+// ApplyRule, so only the rules of running applications are applied again on the
+// next check. The caller must hold rm.mu.
+func (rm *ResolutionMonitor) restoreAllMonitors() {
 	for monitorName := range rm.currentAppRes {
 		monitorDesc := "primary monitor"
 		if monitorName != "" {
@@ -279,19 +956,37 @@ func (rm *ResolutionMonitor) shutdown() error {
 
 		originalRes, exists := rm.originalRes[monitorName]
 		if !exists {
-			log.Printf("Warning: no original resolution stored for %s", monitorDesc)
+			logWarnf("Warning: no original resolution stored for %s", monitorDesc)
 			continue
 		}
 
-		log.Printf("Restoring original resolution on %s before exit...", monitorDesc)
-		if err := rm.displayManager.SetResolution(monitorName, *originalRes); err != nil {
-			log.Printf("Error restoring resolution on %s: %v", monitorDesc, err)
+		log.Printf("Restoring original resolution on %s...", monitorDesc)
+		if err := rm.setResolution(monitorName, *originalRes, "to restore it"); err != nil {
+			logErrorf("Error restoring resolution on %s: %v", monitorDesc, err)
+			continue
 		}
+		rm.recordHistory("restored", monitorName, "", *originalRes)
 	}
 
+	rm.activeApps = make(map[string]AppConfig)
+	rm.forcedApps = make(map[string]bool)
+	rm.currentAppRes = make(map[string]*Resolution)
+	rm.appMonitors = make(map[string]string)
+}
+
+// shutdown performs cleanup before exiting
+func (rm *ResolutionMonitor) shutdown() error {
+	log.Println("Shutting down...")
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	// Restore original resolution on all monitors that were changed
+	rm.restoreAllMonitors()
+
 	// Close config watcher
 	if err := rm.configWatcher.Close(); err != nil {
-		log.Printf("Error closing config watcher: %v", err)
+		logErrorf("Error closing config watcher: %v", err)
 	}
 
 	log.Println("Shutdown complete")
@@ -299,91 +994,87 @@ func (rm *ResolutionMonitor) shutdown() error {
 }
 
 func main() {
-	// Handle version flag
-	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
-		fmt.Println("CS Resolution Monitor")
-		return
-	}
-
-	// Handle help flag
-	if len(os.Args) > 1 && (os.Args[1] == "--help" || os.Args[1] == "-h") {
-		fmt.Println("CS Resolution Monitor")
-		fmt.Println("Usage:")
-		fmt.Println("  csres [config-file]        - Start GUI mode (default)")
-		fmt.Println("  csres --cli [config-file]  - Start CLI mode")
-		fmt.Println("  csres --version            - Show version")
-		fmt.Println("  csres --help               - Show this help")
-		return
-	}
-
-	configFile := DefaultConfigFile
-	cliMode := false
-
-	// Parse command line arguments
-	args := os.Args[1:]
-	for _, arg := range args {
-		switch arg {
-		case "--cli", "-c":
-			cliMode = true
-		default:
-			// If it's not a flag, treat it as config file
-			if !strings.HasPrefix(arg, "-") {
-				configFile = arg
-			}
-		}
-	}
-
-	// If no specific config file was provided but there are args, check if the first non-flag arg is a config file
-	if len(args) > 0 && !strings.HasPrefix(args[0], "-") && !cliMode {
-		configFile = args[0]
-	} else if len(args) > 1 && cliMode && !strings.HasPrefix(args[1], "-") {
-		configFile = args[1]
-	}
-
-	if cliMode {
-		// Run in CLI mode (original behavior)
-		runCLIMode(configFile)
-	} else {
-		// Run in GUI mode (default)
-		runGUIMode(configFile)
-	}
+	os.Exit(Execute(os.Args[1:]))
 }
 
 // runCLIMode runs the application in command-line interface mode
-func runCLIMode(configFile string) {
+func runCLIMode(configFile, profile string, dryRun, jsonOutput bool) error {
 	// Check if config file exists, create default if not
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
 		log.Printf("Config file %s not found, creating default...", configFile)
 		if err := createDefaultConfig(configFile); err != nil {
-			log.Fatalf("Failed to create default config: %v", err)
+			return fmt.Errorf("failed to create default config: %w", err)
 		}
 		log.Printf("Default config created at %s. Please edit it and restart the application.", configFile)
-		return
+		return nil
+	}
+
+	// Claim the config before reading resolutions, a second instance would take the first one's changes as the originals
+	server, err := ListenControl(configFile)
+	if errors.Is(err, errAlreadyRunning) {
+		return forwardLaunch(configFile, profile, dryRun, false)
+	}
+	if err != nil {
+		logWarnf("Warning: control API not available, other instances can't be detected: %v", err)
+	} else {
+		defer server.Close()
+	}
+
+	// Only the instance that owns the config rewrites it, other commands migrate it in memory
+	if _, err := UpgradeConfigFile(configFile, false); err != nil {
+		return err
 	}
 
 	// Create and start monitor
 	monitor, err := NewResolutionMonitor(configFile)
 	if err != nil {
-		log.Fatalf("Failed to create resolution monitor: %v", err)
+		return fmt.Errorf("failed to create resolution monitor: %w", err)
 	}
 
-	if err := monitor.Start(); err != nil {
-		log.Fatalf("Monitor error: %v", err)
+	if dryRun {
+		log.Println("Dry run: resolution changes are logged but not made")
+		monitor.SetDryRun(true)
+	}
+
+	if profile != "" {
+		if err := monitor.SwitchProfile(profile); err != nil {
+			return fmt.Errorf("failed to select profile: %w", err)
+		}
+	}
+
+	// Scripts read status snapshots from standard output, logs go to standard error
+	if jsonOutput {
+		monitor.SetStatusOutput(os.Stdout)
+	}
+
+	if server != nil {
+		server.Serve(engineControl{monitor: monitor}, "run")
 	}
-}
 
-// runGUIMode runs the application in graphical user interface mode
-func runGUIMode(configFile string) {
-	// Create and start GUI
-	gui := NewGUIApp(configFile)
-	if err := gui.Run(); err != nil {
-		log.Fatalf("GUI error: %v", err)
+	// The dashboard is only read on launch, changing it needs a restart
+	if monitor.config.HTTP != nil {
+		dashboard, err := StartDashboard(monitor.config.HTTP, engineControl{monitor: monitor}, "run")
+		if err != nil {
+			logWarnf("Warning: %v", err)
+		} else {
+			defer dashboard.Close()
+		}
 	}
+
+	if err := monitor.Start(); err != nil {
+		return fmt.Errorf("monitor error: %w", err)
+	}
+	return nil
 }
 
 // createDefaultConfig creates a default configuration file
 func createDefaultConfig(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
 	defaultConfig := &Config{
+		Version: CurrentConfigVersion,
 		Applications: []AppConfig{
 			{
 				ProcessName: "cs2.exe",
@@ -399,6 +1090,7 @@ func createDefaultConfig(filename string) error {
 		ShowGUIOnLaunch:     true,
 		StartWithWindows:    false,
 		AutoStartMonitoring: true,
+		PersistResolution:   false,
 	}
 
 	return SaveConfig(defaultConfig, filename)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Monitor identifier prefixes accepted in AppConfig.MonitorName in addition to
+// the empty string (primary monitor) and \\.\DISPLAYn device names
+const (
+	MonitorIDPrefix   = "id:"   // id:MONITOR\DEL40F1\{4d36e96e-e325-11ce-bfc1-08002be10318}\0001
+	MonitorEDIDPrefix = "edid:" // edid:DEL40F1 or edid:DEL40F1:ABC1234 (manufacturer + product code [+ serial])
+	MonitorNamePrefix = "name:" // name:DELL S2721* (case-insensitive pattern on the friendly name)
+)
+
+// isStableMonitorID reports whether a monitor name is a stable identifier
+// that has to be resolved to a device name before use
+func isStableMonitorID(monitorName string) bool {
+	return strings.HasPrefix(monitorName, MonitorIDPrefix) ||
+		strings.HasPrefix(monitorName, MonitorEDIDPrefix) ||
+		strings.HasPrefix(monitorName, MonitorNamePrefix)
+}
+
+// hardwareIDFromMonitorID extracts the manufacturer and product code from a
+// monitor DeviceID, e.g. "MONITOR\DEL40F1\{...}\0001" -> "DEL40F1"
+func hardwareIDFromMonitorID(monitorID string) string {
+	parts := strings.Split(monitorID, `\`)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// matchesMonitor reports whether a stable identifier refers to the given monitor
+func matchesMonitor(identifier string, monitor MonitorInfo) (bool, error) {
+	switch {
+	case strings.HasPrefix(identifier, MonitorIDPrefix):
+		id := strings.TrimPrefix(identifier, MonitorIDPrefix)
+		return monitor.MonitorID != "" && strings.EqualFold(monitor.MonitorID, id), nil
+
+	case strings.HasPrefix(identifier, MonitorEDIDPrefix):
+		hardwareID, serial, hasSerial := strings.Cut(strings.TrimPrefix(identifier, MonitorEDIDPrefix), ":")
+		monitorHardwareID := monitor.HardwareID
+		if monitorHardwareID == "" {
+			monitorHardwareID = hardwareIDFromMonitorID(monitor.MonitorID)
+		}
+		if hardwareID == "" || !strings.EqualFold(monitorHardwareID, hardwareID) {
+			return false, nil
+		}
+		return !hasSerial || strings.EqualFold(monitor.SerialNumber, serial), nil
+
+	case strings.HasPrefix(identifier, MonitorNamePrefix):
+		pattern := strings.ToLower(strings.TrimPrefix(identifier, MonitorNamePrefix))
+		matched, err := path.Match(pattern, strings.ToLower(monitor.DeviceString))
+		if err != nil {
+			return false, fmt.Errorf("invalid monitor name pattern %q: %w", pattern, err)
+		}
+		return matched, nil
+	}
+
+	return strings.EqualFold(identifier, monitor.DeviceName), nil
+}
+
+// resolveMonitorName finds the device name of the monitor a stable identifier refers to
+func resolveMonitorName(identifier string, monitors []MonitorInfo) (string, error) {
+	var matches []string
+	for _, monitor := range monitors {
+		ok, err := matchesMonitor(identifier, monitor)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			matches = append(matches, monitor.DeviceName)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no connected monitor matches %q", identifier)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("monitor identifier %q is ambiguous, it matches %s", identifier, strings.Join(matches, ", "))
+	}
+}
+
+// ResolveMonitor converts a configured monitor name to the current device name.
+// Empty names (primary monitor) and \\.\DISPLAYn device names are returned unchanged.
+func (dm *DisplayManager) ResolveMonitor(monitorName string) (string, error) {
+	if !isStableMonitorID(monitorName) {
+		return monitorName, nil
+	}
+
+	monitors, err := dm.GetAvailableMonitors()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve monitor %q: %w", monitorName, err)
+	}
+
+	return resolveMonitorName(monitorName, monitors)
+}
+
+// stableMonitorID returns the most specific stable identifier of a monitor for use
+// in monitor_name, or "" if it has none
+func stableMonitorID(monitor MonitorInfo) string {
+	if monitor.HardwareID != "" && monitor.SerialNumber != "" {
+		return MonitorEDIDPrefix + monitor.HardwareID + ":" + monitor.SerialNumber
+	}
+	if monitor.MonitorID != "" {
+		return MonitorIDPrefix + monitor.MonitorID
+	}
+	return ""
+}
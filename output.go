@@ -0,0 +1,253 @@
+package main
+
+import (
+	"time"
+
+	"csres/version"
+)
+
+// OutputSchemaVersion is the version of the JSON written with --json. It only
+// changes when a field is removed or changes meaning; fields may be added without
+// a new version, so readers should ignore fields they don't know.
+const OutputSchemaVersion = 1
+
+// MonitorStatus describes a connected monitor
+type MonitorStatus struct {
+	DeviceName string       `json:"device_name"`         // e.g. \\.\DISPLAY1
+	Name       string       `json:"name"`                // Friendly monitor name
+	Primary    bool         `json:"primary"`             // Whether this is the primary monitor
+	StableID   string       `json:"stable_id,omitempty"` // Identifier for monitor_name that survives renumbering
+	Current    *Resolution  `json:"current,omitempty"`   // Current mode, missing if it can't be read
+	Native     *Resolution  `json:"native,omitempty"`    // Preferred mode from the EDID, if reported
+	Baseline   *Resolution  `json:"baseline,omitempty"`  // Engine only: mode restored when no application needs the monitor
+	OwnedBy    []string     `json:"owned_by,omitempty"`  // Engine only: applications whose rule changed this monitor
+	Modes      []Resolution `json:"modes,omitempty"`     // Supported modes, with csres monitors --modes
+}
+
+// AppStatus describes a running application that has a rule
+type AppStatus struct {
+	ProcessName string     `json:"process_name"`
+	MonitorName string     `json:"monitor_name"`          // Monitor as configured, empty = primary
+	DeviceName  string     `json:"device_name,omitempty"` // Monitor the rule was applied to, missing until it is applied
+	Resolution  Resolution `json:"resolution"`            // Mode requested by the rule
+	Applied     bool       `json:"applied"`               // Whether the rule has been applied, false while its monitor is disconnected
+}
+
+// EngineStatus is a snapshot of a running monitor, written by csres run --json
+type EngineStatus struct {
+	SchemaVersion int             `json:"schema_version"`
+	ConfigFile    string          `json:"config_file"`
+	ActiveProfile string          `json:"active_profile"` // Empty when the top-level applications are in use
+	DryRun        bool            `json:"dry_run"`
+	Paused        bool            `json:"paused"` // Rules are not applied until monitoring is resumed
+	Monitors      []MonitorStatus `json:"monitors"`
+	ActiveApps    []AppStatus     `json:"active_apps"`
+}
+
+// ControlStatus is the result of every control API method and the output of csres ctl
+type ControlStatus struct {
+	EngineStatus
+	Mode    string       `json:"mode"` // Command of the running instance, gui or run
+	PID     int          `json:"pid"`
+	Version version.Info `json:"version"`
+}
+
+// MonitorsOutput is the output of csres monitors
+type MonitorsOutput struct {
+	SchemaVersion int             `json:"schema_version"`
+	Monitors      []MonitorStatus `json:"monitors"`
+}
+
+// ModesOutput is the output of csres modes
+type ModesOutput struct {
+	SchemaVersion int          `json:"schema_version"`
+	DeviceName    string       `json:"device_name"`
+	Current       *Resolution  `json:"current,omitempty"`
+	Modes         []Resolution `json:"modes"` // Largest first, fastest refresh rate first
+}
+
+// SetOutput is the output of csres set
+type SetOutput struct {
+	SchemaVersion int         `json:"schema_version"`
+	DeviceName    string      `json:"device_name"`
+	Previous      *Resolution `json:"previous,omitempty"`
+	Resolution    Resolution  `json:"resolution"` // Mode that was set, with the refresh rate that was picked
+	Persistent    bool        `json:"persistent"`
+	DryRun        bool        `json:"dry_run"`
+}
+
+// RuleStatus describes a rule of the active profile in the output of csres status
+type RuleStatus struct {
+	ProcessName string     `json:"process_name"`
+	Resolution  Resolution `json:"resolution"`
+	MonitorName string     `json:"monitor_name"`
+	Running     bool       `json:"running"`
+}
+
+// ConfigStatus is the output of csres status
+type ConfigStatus struct {
+	SchemaVersion     int             `json:"schema_version"`
+	ConfigFile        string          `json:"config_file"`
+	ActiveProfile     string          `json:"active_profile"`
+	Profiles          []string        `json:"profiles"`
+	PollInterval      int             `json:"poll_interval"`
+	PersistResolution bool            `json:"persist_resolution"`
+	Rules             []RuleStatus    `json:"rules"`
+	Monitors          []MonitorStatus `json:"monitors"`
+}
+
+// HistoryEntry is a resolution change made by the engine
+type HistoryEntry struct {
+	Time        time.Time  `json:"time"`
+	DeviceName  string     `json:"device_name"`
+	Action      string     `json:"action"`                 // applied or restored
+	ProcessName string     `json:"process_name,omitempty"` // Application the change was made for, missing when every monitor was restored
+	Resolution  Resolution `json:"resolution"`
+	DryRun      bool       `json:"dry_run"` // The change was only logged
+}
+
+// AppsOutput is the response of the dashboard's /api/apps
+type AppsOutput struct {
+	SchemaVersion int         `json:"schema_version"`
+	ActiveApps    []AppStatus `json:"active_apps"`
+}
+
+// RulesOutput is the response of the dashboard's /api/rules
+type RulesOutput struct {
+	SchemaVersion int          `json:"schema_version"`
+	ActiveProfile string       `json:"active_profile"`
+	Rules         []RuleStatus `json:"rules"`
+}
+
+// HistoryOutput is the response of the dashboard's /api/history
+type HistoryOutput struct {
+	SchemaVersion int            `json:"schema_version"`
+	History       []HistoryEntry `json:"history"` // Oldest first
+}
+
+// Event is something the engine did or noticed, streamed by csres ctl events and
+// the dashboard's /api/events. Fields that don't apply to the type are missing.
+type Event struct {
+	Type        string         `json:"type"` // One of the Event* constants, e.g. process_started
+	Time        time.Time      `json:"time"`
+	PID         int            `json:"pid"`                    // csres process that published the event
+	ProcessName string         `json:"process_name,omitempty"` // Application the event is about
+	ProcessIDs  []uint32       `json:"process_ids,omitempty"`  // Processes of the application, missing for rules applied with ctl apply
+	DeviceName  string         `json:"device_name,omitempty"`  // Monitor that was changed
+	Resolution  *Resolution    `json:"resolution,omitempty"`   // Mode that was set, or requested for apply_failed
+	Monitor     *MonitorStatus `json:"monitor,omitempty"`      // monitor_added and monitor_removed
+	Error       string         `json:"error,omitempty"`        // apply_failed
+	DryRun      bool           `json:"dry_run,omitempty"`      // The change was only logged
+}
+
+// ValidateOutput is the output of csres validate
+type ValidateOutput struct {
+	SchemaVersion int             `json:"schema_version"`
+	ConfigFile    string          `json:"config_file"`
+	Valid         bool            `json:"valid"`
+	Error         string          `json:"error,omitempty"` // Set for problems that aren't about a single value, e.g. a missing file
+	Issues        []ValidateIssue `json:"issues"`
+}
+
+// ValidateIssue is a single problem in the output of csres validate
+type ValidateIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// VersionOutput is the output of csres version
+type VersionOutput struct {
+	SchemaVersion int `json:"schema_version"`
+	version.Info
+}
+
+// DoctorReport is the support bundle written by csres doctor. Usernames are
+// removed from every path in it.
+type DoctorReport struct {
+	SchemaVersion int               `json:"schema_version"`
+	GeneratedAt   time.Time         `json:"generated_at"`
+	Version       version.Info      `json:"version"`
+	Config        DoctorConfig      `json:"config"`
+	Monitors      []DoctorMonitor   `json:"monitors"`
+	WMIDevices    []DoctorWMIDevice `json:"wmi_devices"` // Display PnP entities reported by WMI, used for monitor names
+	Startup       DoctorStartup     `json:"startup"`
+	LogFile       string            `json:"log_file,omitempty"`
+	Log           []string          `json:"log"`      // Most recent lines of the log file
+	Problems      []string          `json:"problems"` // Information that could not be collected
+}
+
+// DoctorConfig describes the config file in a support bundle
+type DoctorConfig struct {
+	Path          string             `json:"path"`
+	Source        string             `json:"source"` // Where the path came from, e.g. "command line"
+	Valid         bool               `json:"valid"`
+	Error         string             `json:"error,omitempty"`
+	Issues        []ValidateIssue    `json:"issues"`
+	Files         []DoctorConfigFile `json:"files"`               // Main file and its layers, in merge order
+	ActiveProfile string             `json:"active_profile"`      // Empty when the top-level applications are in use
+	Effective     *Config            `json:"effective,omitempty"` // Merged config with defaults, missing if it failed to load
+}
+
+// DoctorConfigFile is a file that makes up the config
+type DoctorConfigFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// DoctorMonitor describes a monitor in a support bundle
+type DoctorMonitor struct {
+	MonitorStatus
+	MonitorID    string      `json:"monitor_id,omitempty"`
+	PNPDeviceID  string      `json:"pnp_device_id,omitempty"`
+	HardwareID   string      `json:"hardware_id,omitempty"`
+	SerialNumber string      `json:"serial_number,omitempty"`
+	Registry     *Resolution `json:"registry,omitempty"` // Mode stored in the registry, applied by Windows at sign-in
+}
+
+// DoctorWMIDevice is a display PnP entity reported by WMI
+type DoctorWMIDevice struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	DeviceID    string `json:"device_id"`
+	PNPDeviceID string `json:"pnp_device_id"`
+	Status      string `json:"status"`
+}
+
+// DoctorStartup describes the Windows startup registration
+type DoctorStartup struct {
+	Registered bool   `json:"registered"`
+	Command    string `json:"command,omitempty"`
+}
+
+// newRuleStatuses describes the enabled rules of a config and whether their
+// application is running
+func newRuleStatuses(config *Config, running map[string]AppConfig) []RuleStatus {
+	rules := []RuleStatus{}
+	for _, app := range config.Rules() {
+		if app.Disabled {
+			continue
+		}
+		_, isRunning := running[app.ProcessName]
+		rules = append(rules, RuleStatus{
+			ProcessName: app.ProcessName,
+			Resolution:  app.Resolution,
+			MonitorName: app.MonitorName,
+			Running:     isRunning,
+		})
+	}
+	return rules
+}
+
+// newMonitorStatus returns the description of a monitor without its modes or engine state
+func newMonitorStatus(monitor MonitorInfo) MonitorStatus {
+	return MonitorStatus{
+		DeviceName: monitor.DeviceName,
+		Name:       monitor.DeviceString,
+		Primary:    monitor.IsPrimary,
+		StableID:   stableMonitorID(monitor),
+		Native:     monitor.NativeResolution,
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcessMonitor handles process monitoring functionality
+type ProcessMonitor struct {
+	procDir string // Where the processes are listed, /proc outside of tests
+}
+
+// NewProcessMonitor creates a new ProcessMonitor instance
+func NewProcessMonitor() *ProcessMonitor {
+	return &ProcessMonitor{procDir: procDir}
+}
+
+// forEachProcess calls fn with the ID and executable name of every running process
+func (pm *ProcessMonitor) forEachProcess(fn func(pid uint32, processName string)) error {
+	entries, err := os.ReadDir(pm.procDir)
+	if err != nil {
+		return fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue // Not a process
+		}
+
+		// Processes may exit while the list is read
+		cmdline, _ := os.ReadFile(filepath.Join(pm.procDir, entry.Name(), "cmdline"))
+		comm, _ := os.ReadFile(filepath.Join(pm.procDir, entry.Name(), "comm"))
+		if name := linuxProcessName(cmdline, comm); name != "" {
+			fn(uint32(pid), name)
+		}
+	}
+
+	return nil
+}
+
+// linuxProcessName returns the executable name of a process from its cmdline and
+// comm files. The name is taken from the first argument, which is the full
+// Windows path for programs running in Wine or Proton, e.g. C:\Games\cs2.exe.
+// comm is cut off after 15 characters and only used for kernel threads and
+// processes without arguments.
+func linuxProcessName(cmdline, comm []byte) string {
+	program, _, _ := bytes.Cut(cmdline, []byte{0})
+	if len(program) == 0 {
+		return strings.TrimSpace(string(comm))
+	}
+
+	name := string(program)
+	if i := strings.LastIndexAny(name, `/\`); i != -1 {
+		name = name[i+1:]
+	}
+	return name
+}
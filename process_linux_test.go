@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinuxProcessName(t *testing.T) {
+	tests := []struct {
+		cmdline string
+		comm    string
+		want    string
+	}{
+		{"/usr/bin/steam\x00-silent\x00", "steam\n", "steam"},
+		// Games running in Proton show their Windows path
+		{"C:\\Program Files (x86)\\Steam\\steamapps\\common\\Counter-Strike Global Offensive\\game\\bin\\win64\\cs2.exe\x00", "cs2.exe\n", "cs2.exe"},
+		{"Z:\\home\\user\\Games\\VeryLongGameName.exe\x00", "VeryLongGameNam\n", "VeryLongGameName.exe"},
+		// Kernel threads have no arguments
+		{"", "kworker/0:1\n", "kworker/0:1"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := linuxProcessName([]byte(tt.cmdline), []byte(tt.comm)); got != tt.want {
+			t.Errorf("linuxProcessName(%q, %q) = %q, want %q", tt.cmdline, tt.comm, got, tt.want)
+		}
+	}
+}
+
+func TestGetProcessIDs(t *testing.T) {
+	dir := t.TempDir()
+	processes := map[string]string{
+		"100": "/usr/bin/steam\x00",
+		"200": "C:\\Games\\cs2.exe\x00-novid\x00",
+		"201": "C:\\Games\\CS2.EXE\x00",
+	}
+	for pid, cmdline := range processes {
+		if err := os.Mkdir(filepath.Join(dir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, filepath.Join(dir, pid, "cmdline"), []byte(cmdline))
+	}
+	// Entries that aren't processes are skipped
+	writeTestFile(t, filepath.Join(dir, "uptime"), []byte("1234.56 789.00\n"))
+
+	pm := &ProcessMonitor{procDir: dir}
+	pids, err := pm.GetProcessIDs("cs2.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 2 {
+		t.Errorf("got pids %v, want 200 and 201", pids)
+	}
+
+	running, err := pm.IsProcessRunning("steam")
+	if err != nil || !running {
+		t.Errorf("IsProcessRunning(steam) = %v, %v, want true", running, err)
+	}
+}
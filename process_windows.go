@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	TH32CS_SNAPPROCESS   = 0x00000002
+	INVALID_HANDLE_VALUE = ^uintptr(0)
+)
+
+// PROCESSENTRY32 represents an entry in the system's process list
+type PROCESSENTRY32 struct {
+	DwSize              uint32
+	CntUsage            uint32
+	Th32ProcessID       uint32
+	Th32DefaultHeapID   uintptr
+	Th32ModuleID        uint32
+	CntThreads          uint32
+	Th32ParentProcessID uint32
+	PcPriClassBase      int32
+	DwFlags             uint32
+	SzExeFile           [260]uint16 // MAX_PATH
+}
+
+// ProcessMonitor handles process monitoring functionality
+type ProcessMonitor struct {
+	kernel32dll                  *syscall.LazyDLL
+	procCreateToolhelp32Snapshot *syscall.LazyProc
+	procProcess32FirstW          *syscall.LazyProc
+	procProcess32NextW           *syscall.LazyProc
+	procCloseHandle              *syscall.LazyProc
+}
+
+// NewProcessMonitor creates a new ProcessMonitor instance
+func NewProcessMonitor() *ProcessMonitor {
+	kernel32dll := syscall.NewLazyDLL("kernel32.dll")
+	return &ProcessMonitor{
+		kernel32dll:                  kernel32dll,
+		procCreateToolhelp32Snapshot: kernel32dll.NewProc("CreateToolhelp32Snapshot"),
+		procProcess32FirstW:          kernel32dll.NewProc("Process32FirstW"),
+		procProcess32NextW:           kernel32dll.NewProc("Process32NextW"),
+		procCloseHandle:              kernel32dll.NewProc("CloseHandle"),
+	}
+}
+
+// forEachProcess calls fn with the ID and executable name of every entry of a
+// snapshot of the system's process list
+func (pm *ProcessMonitor) forEachProcess(fn func(pid uint32, processName string)) error {
+	snapshot, _, _ := pm.procCreateToolhelp32Snapshot.Call(
+		uintptr(TH32CS_SNAPPROCESS),
+		uintptr(0),
+	)
+
+	if snapshot == INVALID_HANDLE_VALUE {
+		return fmt.Errorf("failed to create process snapshot")
+	}
+	defer pm.procCloseHandle.Call(snapshot)
+
+	var pe32 PROCESSENTRY32
+	pe32.DwSize = uint32(unsafe.Sizeof(pe32))
+
+	// Get first process
+	ret, _, _ := pm.procProcess32FirstW.Call(snapshot, uintptr(unsafe.Pointer(&pe32)))
+	if ret == 0 {
+		return fmt.Errorf("failed to get first process")
+	}
+
+	for {
+		fn(pe32.Th32ProcessID, syscall.UTF16ToString(pe32.SzExeFile[:]))
+
+		// Get next process
+		ret, _, _ := pm.procProcess32NextW.Call(snapshot, uintptr(unsafe.Pointer(&pe32)))
+		if ret == 0 {
+			break // No more processes
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is a named set of application rules, e.g. "competitive" or "streaming".
+// Settings left out of a profile fall back to the top-level value.
+type Profile struct {
+	Name              string      `json:"name"`
+	Applications      []AppConfig `json:"applications"`
+	PollInterval      *int        `json:"poll_interval,omitempty" min:"1"` // Optional: overrides poll_interval while the profile is active
+	PersistResolution *bool       `json:"persist_resolution,omitempty"`    // Optional: overrides persist_resolution while the profile is active
+	Disabled          bool        `json:"disabled,omitempty"`              // Optional: removes a profile inherited from another config layer
+}
+
+// Profile returns the profile with the given name (case-insensitive), or nil if
+// there is none or it is disabled
+func (c *Config) Profile(name string) *Profile {
+	for i := range c.Profiles {
+		if strings.EqualFold(c.Profiles[i].Name, name) && !c.Profiles[i].Disabled {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// activeProfile returns the selected profile, or nil when the top-level rules are in use
+func (c *Config) activeProfile() *Profile {
+	if c.ActiveProfile == "" {
+		return nil
+	}
+	return c.Profile(c.ActiveProfile)
+}
+
+// SelectProfile makes the named profile active. An empty name selects the
+// top-level applications list.
+func (c *Config) SelectProfile(name string) error {
+	if name == "" {
+		c.ActiveProfile = ""
+		return nil
+	}
+
+	profile := c.Profile(name)
+	if profile == nil {
+		return fmt.Errorf("unknown profile %q, available profiles: %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	c.ActiveProfile = profile.Name
+	return nil
+}
+
+// ProfileNames returns the names of all enabled profiles in file order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for _, profile := range c.Profiles {
+		if profile.Disabled {
+			continue
+		}
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// Rules returns the application rules of the active profile, or the top-level
+// rules when no profile is selected
+func (c *Config) Rules() []AppConfig {
+	if profile := c.activeProfile(); profile != nil {
+		return profile.Applications
+	}
+	return c.Applications
+}
+
+// SetRules replaces the application rules of the active profile, or the
+// top-level rules when no profile is selected
+func (c *Config) SetRules(apps []AppConfig) {
+	if profile := c.activeProfile(); profile != nil {
+		profile.Applications = apps
+		return
+	}
+	c.Applications = apps
+}
+
+// rulesPath returns the config path of the active rules, used in diagnostics
+func (c *Config) rulesPath() string {
+	for i := range c.Profiles {
+		if c.ActiveProfile != "" && strings.EqualFold(c.Profiles[i].Name, c.ActiveProfile) {
+			return fmt.Sprintf("profiles[%d].applications", i)
+		}
+	}
+	return "applications"
+}
+
+// EffectivePollInterval returns the poll interval of the active profile, falling
+// back to the top-level setting
+func (c *Config) EffectivePollInterval() int {
+	if profile := c.activeProfile(); profile != nil && profile.PollInterval != nil {
+		return *profile.PollInterval
+	}
+	return c.PollInterval
+}
+
+// EffectivePersistResolution returns the persist_resolution setting of the active
+// profile, falling back to the top-level setting
+func (c *Config) EffectivePersistResolution() bool {
+	if profile := c.activeProfile(); profile != nil && profile.PersistResolution != nil {
+		return *profile.PersistResolution
+	}
+	return c.PersistResolution
+}
@@ -0,0 +1,100 @@
+// Package version identifies a csres build. Release builds set Version, and
+// optionally Commit and Date, with -ldflags; other builds fall back to the
+// information the Go toolchain embeds in the binary.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X csres/version.Version=1.2.0 -X csres/version.Commit=abc1234"
+var (
+	Version = "" // Release version, a leading "v" is stripped
+	Commit  = "" // VCS revision, defaults to the one recorded by the Go toolchain
+	Date    = "" // Build or commit date, defaults to the commit time recorded by the Go toolchain
+)
+
+// devVersion is reported by builds that have no version
+const devVersion = "dev"
+
+// Info describes a build
+type Info struct {
+	Version   string `json:"version"`            // e.g. 1.2.0, or "dev"
+	Commit    string `json:"commit,omitempty"`   // VCS revision
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with uncommitted changes
+	Date      string `json:"date,omitempty"`     // Build or commit date
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+// Get returns the version information of the running binary
+func Get() Info {
+	info := Info{
+		Version:   strings.TrimPrefix(Version, "v"),
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		// Set by go install module@version, "(devel)" for builds from a checkout
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = strings.TrimPrefix(build.Main.Version, "v")
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = devVersion
+	}
+	return info
+}
+
+// Short returns the version for display, e.g. "v1.2.0" or "dev"
+func (i Info) Short() string {
+	if i.Version == devVersion {
+		return devVersion
+	}
+	return "v" + i.Version
+}
+
+// String returns the version with the commit and build details, e.g.
+// "v1.2.0 (abc1234def56, 2026-01-02T15:04:05Z, go1.24.1 windows/amd64)"
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if i.Modified {
+			commit += "-modified"
+		}
+		details = append(details, commit)
+	}
+	if i.Date != "" {
+		details = append(details, i.Date)
+	}
+	details = append(details, fmt.Sprintf("%s %s", i.GoVersion, i.Platform))
+
+	return fmt.Sprintf("%s (%s)", i.Short(), strings.Join(details, ", "))
+}
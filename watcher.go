@@ -1,17 +1,29 @@
 package main
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// configReloadDelay is how long the watcher waits for a burst of file events
+// (e.g. several writes from one save) to settle before reloading
+const configReloadDelay = 250 * time.Millisecond
+
 // ConfigWatcher handles monitoring of configuration file changes
 type ConfigWatcher struct {
 	watcher    *fsnotify.Watcher
 	configPath string
+	lastHash   [32]byte // Hash of the content of all config layers that was last loaded
 	configChan chan *Config
 	errorChan  chan error
 }
@@ -30,14 +42,21 @@ func NewConfigWatcher(configPath string) (*ConfigWatcher, error) {
 		errorChan:  make(chan error, 1),
 	}
 
+	// Remember the current content so saves that don't change anything are ignored
+	cw.lastHash = cw.layersHash()
+
 	// Watch the directory containing the config file
-	// This is more reliable than watching the file directly
+	// This is more reliable than watching the file directly, and it keeps working
+	// when editors replace the file by renaming a temporary file over it
 	configDir := filepath.Dir(configPath)
 	if err := watcher.Add(configDir); err != nil {
 		watcher.Close()
 		return nil, fmt.Errorf("failed to watch config directory: %w", err)
 	}
 
+	// Watch the drop-in directory too, it is added later if it doesn't exist yet
+	cw.watchDropInDir()
+
 	return cw, nil
 }
 
@@ -46,6 +65,11 @@ func (cw *ConfigWatcher) Start() {
 	go func() {
 		defer cw.watcher.Close()
 
+		// Reloads are debounced: every event for the config file restarts the timer
+		reloadTimer := time.NewTimer(configReloadDelay)
+		reloadTimer.Stop()
+		defer reloadTimer.Stop()
+
 		for {
 			select {
 			case event, ok := <-cw.watcher.Events:
@@ -53,39 +77,135 @@ func (cw *ConfigWatcher) Start() {
 					return
 				}
 
-				// Check if the event is for our config file
-				if filepath.Clean(event.Name) == filepath.Clean(cw.configPath) {
-					// Only respond to write events (file modifications)
-					if event.Op&fsnotify.Write == fsnotify.Write {
-						log.Printf("Config file modified: %s", event.Name)
-
-						// Load the updated configuration
-						config, err := LoadConfig(cw.configPath)
-						if err != nil {
-							cw.errorChan <- fmt.Errorf("failed to reload config: %w", err)
-							continue
-						}
-
-						// Send the new config to the channel
-						select {
-						case cw.configChan <- config:
-						default:
-							// Channel is full, skip this update
-							log.Println("Config channel full, skipping update")
-						}
-					}
+				// A new conf.d directory has to be watched before its files are seen
+				if event.Op&fsnotify.Create != 0 && cw.isDropInDir(event.Name) {
+					cw.watchDropInDir()
+					reloadTimer.Reset(configReloadDelay)
+				}
+
+				// Check if the event is for one of our config files. Editors that save
+				// atomically produce Create/Rename events instead of Write, and some remove
+				// the file before recreating it, so all of them schedule a reload.
+				if cw.isConfigFile(event.Name) && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+					reloadTimer.Reset(configReloadDelay)
 				}
 
+			case <-reloadTimer.C:
+				cw.reload()
+
 			case err, ok := <-cw.watcher.Errors:
 				if !ok {
 					return
 				}
-				cw.errorChan <- fmt.Errorf("file watcher error: %w", err)
+				cw.sendError(fmt.Errorf("file watcher error: %w", err))
 			}
 		}
 	}()
 }
 
+// isConfigFile reports whether a watcher event refers to a layer of the config:
+// the main file, a file in conf.d or the per-user override file
+func (cw *ConfigWatcher) isConfigFile(name string) bool {
+	if samePath(name, cw.configPath) {
+		return true
+	}
+	if samePath(filepath.Dir(name), configDropInDir(cw.configPath)) && isConfigExtension(name) {
+		return true
+	}
+	for _, candidate := range userConfigCandidates(cw.configPath) {
+		if samePath(name, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDropInDir reports whether a path is the conf.d directory of the config
+func (cw *ConfigWatcher) isDropInDir(name string) bool {
+	return samePath(name, configDropInDir(cw.configPath))
+}
+
+// watchDropInDir starts watching the conf.d directory if it exists
+func (cw *ConfigWatcher) watchDropInDir() {
+	dir := configDropInDir(cw.configPath)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	if err := cw.watcher.Add(dir); err != nil {
+		logWarnf("Warning: failed to watch config directory %s: %v", dir, err)
+	}
+}
+
+// samePath compares two file paths, ignoring case on Windows
+func samePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// layersHash hashes the names and content of all config layers
+func (cw *ConfigWatcher) layersHash() [32]byte {
+	hash := sha256.New()
+	for _, file := range ConfigLayerFiles(cw.configPath) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", file, len(data))
+		hash.Write(data)
+	}
+
+	var sum [32]byte
+	copy(sum[:], hash.Sum(nil))
+	return sum
+}
+
+// reload loads the config after a burst of events has settled
+func (cw *ConfigWatcher) reload() {
+	if _, err := os.Stat(cw.configPath); errors.Is(err, fs.ErrNotExist) {
+		// Removed or renamed away, the new file will trigger another reload when it appears
+		return
+	}
+
+	// Skip saves that didn't change the content of any layer
+	hash := cw.layersHash()
+	if hash == cw.lastHash {
+		return
+	}
+
+	log.Printf("Config files modified: %s", strings.Join(ConfigLayerFiles(cw.configPath), ", "))
+
+	// Load the updated configuration. An invalid file is only reported, no update
+	// is sent so the last valid config stays in use.
+	config, err := LoadConfig(cw.configPath)
+	if err != nil {
+		cw.sendError(fmt.Errorf("failed to reload config (keeping last valid configuration): %w", err))
+		return
+	}
+	cw.lastHash = hash
+
+	// Send the new config to the channel, replacing an update that hasn't been picked up yet
+	select {
+	case <-cw.configChan:
+		log.Println("Replacing pending config update with newer one")
+	default:
+	}
+	cw.configChan <- config
+}
+
+// sendError reports an error without waiting for it to be received. While an
+// earlier error is still pending the new one is only logged, so a receiver that
+// is busy doesn't stop the watcher.
+func (cw *ConfigWatcher) sendError(err error) {
+	select {
+	case cw.errorChan <- err:
+	default:
+		logErrorf("Error: %v", err)
+	}
+}
+
 // ConfigChan returns the channel that receives updated configurations
 func (cw *ConfigWatcher) ConfigChan() <-chan *Config {
 	return cw.configChan
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// watcherTimeout is how long the tests wait for a reload that should happen
+const watcherTimeout = 5 * time.Second
+
+// testConfig returns a config file with one rule and the given poll interval,
+// which the tests use to tell reloads apart
+func testConfig(pollInterval int) []byte {
+	return fmt.Appendf(nil, `{
+  "version": %d,
+  "applications": [
+    {"process_name": "cs2.exe", "resolution": {"width": 1280, "height": 960}, "monitor_name": ""}
+  ],
+  "poll_interval": %d
+}`, CurrentConfigVersion, pollInterval)
+}
+
+// startTestWatcher writes a config file to a temporary directory and watches it
+func startTestWatcher(t *testing.T) (*ConfigWatcher, string) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, configPath, testConfig(2))
+
+	cw, err := NewConfigWatcher(configPath)
+	if err != nil {
+		t.Fatalf("NewConfigWatcher: %v", err)
+	}
+	cw.Start()
+	t.Cleanup(func() { cw.Close() })
+	return cw, configPath
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForConfig returns the next config the watcher loads
+func waitForConfig(t *testing.T, cw *ConfigWatcher) *Config {
+	t.Helper()
+	select {
+	case config := <-cw.ConfigChan():
+		return config
+	case err := <-cw.ErrorChan():
+		t.Fatalf("watcher error: %v", err)
+	case <-time.After(watcherTimeout):
+		t.Fatal("config was not reloaded")
+	}
+	return nil
+}
+
+// expectNoReload fails if the watcher loads a config within twice the reload delay
+func expectNoReload(t *testing.T, cw *ConfigWatcher) {
+	t.Helper()
+	select {
+	case config := <-cw.ConfigChan():
+		t.Fatalf("unexpected reload with poll_interval %d", config.PollInterval)
+	case err := <-cw.ErrorChan():
+		t.Fatalf("watcher error: %v", err)
+	case <-time.After(2 * configReloadDelay):
+	}
+}
+
+func TestConfigWatcherAtomicReplace(t *testing.T) {
+	cw, configPath := startTestWatcher(t)
+
+	// Editors write a temporary file and rename it over the original
+	tempPath := configPath + ".tmp"
+	writeTestFile(t, tempPath, testConfig(5))
+	if err := os.Rename(tempPath, configPath); err != nil {
+		t.Fatal(err)
+	}
+	if config := waitForConfig(t, cw); config.PollInterval != 5 {
+		t.Errorf("reloaded poll_interval %d, want 5", config.PollInterval)
+	}
+
+	// Others remove the file before writing the new one
+	if err := os.Remove(configPath); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, configPath, testConfig(7))
+	if config := waitForConfig(t, cw); config.PollInterval != 7 {
+		t.Errorf("reloaded poll_interval %d, want 7", config.PollInterval)
+	}
+}
+
+func TestConfigWatcherDropInFragments(t *testing.T) {
+	cw, configPath := startTestWatcher(t)
+
+	// conf.d doesn't exist when the watcher starts, creating it is picked up too
+	dropInDir := configDropInDir(configPath)
+	if err := os.Mkdir(dropInDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fragment := filepath.Join(dropInDir, "10-games.json")
+	writeTestFile(t, fragment, []byte(`{
+  "applications": [
+    {"process_name": "valorant.exe", "resolution": {"width": 1920, "height": 1080}, "monitor_name": ""}
+  ]
+}`))
+	config := waitForConfig(t, cw)
+	if len(config.Applications) != 2 {
+		t.Fatalf("got %d applications after adding a fragment, want 2", len(config.Applications))
+	}
+
+	// Files that aren't config files are ignored
+	writeTestFile(t, filepath.Join(dropInDir, "notes.txt"), []byte("not a config"))
+	expectNoReload(t, cw)
+
+	if err := os.Remove(fragment); err != nil {
+		t.Fatal(err)
+	}
+	config = waitForConfig(t, cw)
+	if len(config.Applications) != 1 {
+		t.Errorf("got %d applications after removing the fragment, want 1", len(config.Applications))
+	}
+}
+
+func TestConfigWatcherDebounce(t *testing.T) {
+	cw, configPath := startTestWatcher(t)
+
+	// A burst of writes shorter than the reload delay is loaded once, with the last content
+	for pollInterval := 3; pollInterval <= 6; pollInterval++ {
+		writeTestFile(t, configPath, testConfig(pollInterval))
+		time.Sleep(configReloadDelay / 5)
+	}
+	if config := waitForConfig(t, cw); config.PollInterval != 6 {
+		t.Errorf("reloaded poll_interval %d, want the last written 6", config.PollInterval)
+	}
+	expectNoReload(t, cw)
+
+	// Saving the same content again doesn't reload
+	writeTestFile(t, configPath, testConfig(6))
+	expectNoReload(t, cw)
+}
+
+func TestConfigWatcherErrorsDontBlock(t *testing.T) {
+	cw, configPath := startTestWatcher(t)
+
+	// Two invalid saves while nobody reads the errors, the second one is only logged
+	writeTestFile(t, configPath, []byte(`{"applications": [`))
+	time.Sleep(2 * configReloadDelay)
+	writeTestFile(t, configPath, []byte(`{"applications": [{`))
+	time.Sleep(2 * configReloadDelay)
+
+	// The watcher keeps going and loads the next valid save
+	writeTestFile(t, configPath, testConfig(4))
+	select {
+	case config := <-cw.ConfigChan():
+		if config.PollInterval != 4 {
+			t.Errorf("reloaded poll_interval %d, want 4", config.PollInterval)
+		}
+	case <-time.After(watcherTimeout):
+		t.Fatal("config was not reloaded after errors went unread")
+	}
+	if err := <-cw.ErrorChan(); err == nil {
+		t.Error("want the first error to stay pending")
+	}
+}